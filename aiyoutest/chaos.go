@@ -0,0 +1,303 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyoutest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault est un type de défaillance injectée par Chaos
+type Fault string
+
+const (
+	// FaultLatency retarde l'envoi de la requête
+	FaultLatency Fault = "latency"
+
+	// FaultReset simule une connexion réinitialisée par le serveur
+	FaultReset Fault = "reset"
+
+	// FaultStatus renvoie un code d'erreur HTTP sans contacter le serveur
+	FaultStatus Fault = "status"
+
+	// FaultTruncate coupe le corps d'une réponse non streamée
+	FaultTruncate Fault = "truncate"
+
+	// FaultDisconnect coupe un stream SSE en cours de réception
+	FaultDisconnect Fault = "disconnect"
+
+	// FaultCorrupt rend invalide une ligne de données d'un stream SSE
+	FaultCorrupt Fault = "corrupt"
+)
+
+// defaultChaosStatuses sont les codes d'erreur injectés par défaut
+var defaultChaosStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+}
+
+// ChaosConfig configure les défaillances injectées. Les taux sont des
+// probabilités entre 0 et 1, tirées indépendamment pour chaque requête.
+type ChaosConfig struct {
+	// Seed initialise le générateur aléatoire, pour des scénarios reproductibles
+	Seed int64
+
+	// LatencyRate est la probabilité d'ajouter un délai, uniforme entre 0 et MaxLatency
+	LatencyRate float64
+	MaxLatency  time.Duration
+
+	// ResetRate est la probabilité d'une connexion réinitialisée
+	ResetRate float64
+
+	// StatusRate est la probabilité d'une réponse d'erreur, dont le code est
+	// tiré parmi Statuses (429, 500, 502 et 503 par défaut)
+	StatusRate float64
+	Statuses   []int
+
+	// TruncateRate est la probabilité de couper un corps non streamé
+	TruncateRate float64
+
+	// DisconnectRate est la probabilité de couper un stream SSE
+	DisconnectRate float64
+
+	// CorruptRate est la probabilité de corrompre une ligne d'un stream SSE
+	CorruptRate float64
+}
+
+// Chaos est un http.RoundTripper qui injecte des défaillances aléatoires
+// autour d'un transport réel, à utiliser avec aiyou.WithTransport
+type Chaos struct {
+	next   http.RoundTripper
+	config ChaosConfig
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	faults map[Fault]int
+}
+
+// NewChaos crée un transport injectant des défaillances autour de next
+// (http.DefaultTransport s'il est nil)
+func NewChaos(next http.RoundTripper, config ChaosConfig) *Chaos {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if len(config.Statuses) == 0 {
+		config.Statuses = defaultChaosStatuses
+	}
+	return &Chaos{
+		next:   next,
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+		faults: make(map[Fault]int),
+	}
+}
+
+// Faults retourne le nombre de défaillances injectées, par type
+func (c *Chaos) Faults() map[Fault]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	faults := make(map[Fault]int, len(c.faults))
+	for k, v := range c.faults {
+		faults[k] = v
+	}
+	return faults
+}
+
+// plan est le tirage des défaillances d'une requête
+type plan struct {
+	latency    time.Duration
+	reset      bool
+	status     int
+	truncate   bool
+	disconnect int // octets transmis avant la coupure (0 : pas de coupure)
+	corrupt    int // rang de la ligne de données corrompue (-1 : aucune)
+}
+
+// draw tire les défaillances d'une requête
+func (c *Chaos) draw() plan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hit := func(rate float64) bool { return rate > 0 && c.rng.Float64() < rate }
+
+	p := plan{corrupt: -1}
+	if hit(c.config.LatencyRate) && c.config.MaxLatency > 0 {
+		p.latency = time.Duration(c.rng.Int63n(int64(c.config.MaxLatency)))
+		c.faults[FaultLatency]++
+	}
+	switch {
+	case hit(c.config.ResetRate):
+		p.reset = true
+		c.faults[FaultReset]++
+	case hit(c.config.StatusRate):
+		p.status = c.config.Statuses[c.rng.Intn(len(c.config.Statuses))]
+		c.faults[FaultStatus]++
+	}
+	p.truncate = hit(c.config.TruncateRate)
+	if hit(c.config.DisconnectRate) {
+		p.disconnect = 1 + c.rng.Intn(256)
+	}
+	if hit(c.config.CorruptRate) {
+		p.corrupt = c.rng.Intn(3)
+	}
+	return p
+}
+
+// count enregistre une défaillance effectivement injectée
+func (c *Chaos) count(f Fault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults[f]++
+}
+
+// RoundTrip implémente http.RoundTripper
+func (c *Chaos) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := c.draw()
+
+	if p.latency > 0 {
+		select {
+		case <-time.After(p.latency):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	if p.reset {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("aiyoutest: chaos: %w", syscall.ECONNRESET)
+	}
+	if p.status != 0 {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		text := http.StatusText(p.status)
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", p.status, text),
+			StatusCode: p.status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+			Body:       io.NopCloser(strings.NewReader(text)),
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := c.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		if p.truncate {
+			c.count(FaultTruncate)
+			resp.Body = truncate(resp.Body)
+			resp.ContentLength = -1
+			resp.Header.Del("Content-Length")
+		}
+		return resp, nil
+	}
+	if p.corrupt >= 0 {
+		resp.Body = &corruptReader{chaos: c, body: resp.Body, reader: bufio.NewReader(resp.Body), target: p.corrupt}
+	}
+	if p.disconnect > 0 {
+		resp.Body = &disconnectReader{chaos: c, body: resp.Body, remaining: p.disconnect}
+	}
+	return resp, nil
+}
+
+// truncate retourne la première moitié du corps, suivie d'une coupure
+func truncate(body io.ReadCloser) io.ReadCloser {
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return io.NopCloser(&errReader{err: err})
+	}
+	return io.NopCloser(io.MultiReader(bytes.NewReader(data[:len(data)/2]), &errReader{err: io.ErrUnexpectedEOF}))
+}
+
+// errReader retourne toujours la même erreur
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// disconnectReader coupe le stream après remaining octets
+type disconnectReader struct {
+	chaos     *Chaos
+	body      io.ReadCloser
+	remaining int
+}
+
+func (d *disconnectReader) Read(p []byte) (int, error) {
+	if d.remaining <= 0 {
+		return 0, fmt.Errorf("aiyoutest: chaos: %w", io.ErrUnexpectedEOF)
+	}
+	if len(p) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.body.Read(p)
+	d.remaining -= n
+	if d.remaining <= 0 && err == nil {
+		d.chaos.count(FaultDisconnect)
+	}
+	return n, err
+}
+
+func (d *disconnectReader) Close() error {
+	return d.body.Close()
+}
+
+// corruptReader tronque la ligne de données de rang target du stream
+type corruptReader struct {
+	chaos   *Chaos
+	body    io.ReadCloser
+	reader  *bufio.Reader
+	target  int
+	seen    int
+	pending []byte
+}
+
+func (c *corruptReader) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		line, err := c.reader.ReadBytes('\n')
+		if bytes.HasPrefix(line, []byte("data:")) && !bytes.Contains(line, []byte("[DONE]")) {
+			if c.seen == c.target {
+				// Ligne JSON coupée en son milieu
+				line = append(line[:len(line)/2:len(line)/2], '\n')
+				c.chaos.count(FaultCorrupt)
+			}
+			c.seen++
+		}
+		c.pending = line
+		if err != nil {
+			if len(line) == 0 {
+				return 0, err
+			}
+			break
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *corruptReader) Close() error {
+	return c.body.Close()
+}
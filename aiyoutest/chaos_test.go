@@ -0,0 +1,138 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyoutest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	aiyou "github.com/n1neT10ne/aiyou-go-sdk"
+)
+
+func TestChaosFaults(t *testing.T) {
+	longText := strings.Repeat("word ", 100)
+
+	tests := []struct {
+		name      string
+		config    ChaosConfig
+		stream    bool
+		wantErr   error
+		wantFault Fault
+	}{
+		{
+			name:      "connection reset",
+			config:    ChaosConfig{ResetRate: 1},
+			wantErr:   syscall.ECONNRESET,
+			wantFault: FaultReset,
+		},
+		{
+			name:      "error status",
+			config:    ChaosConfig{StatusRate: 1, Statuses: []int{429}},
+			wantErr:   aiyou.ErrRateLimit,
+			wantFault: FaultStatus,
+		},
+		{
+			name:      "truncated body",
+			config:    ChaosConfig{TruncateRate: 1},
+			wantErr:   io.ErrUnexpectedEOF,
+			wantFault: FaultTruncate,
+		},
+		{
+			name:      "mid-stream disconnect",
+			config:    ChaosConfig{DisconnectRate: 1},
+			stream:    true,
+			wantErr:   io.ErrUnexpectedEOF,
+			wantFault: FaultDisconnect,
+		},
+		{
+			name:      "corrupt SSE line",
+			config:    ChaosConfig{CorruptRate: 1},
+			stream:    true,
+			wantErr:   aiyou.ErrStreamCorrupted,
+			wantFault: FaultCorrupt,
+		},
+		{
+			name:      "latency",
+			config:    ChaosConfig{LatencyRate: 1, MaxLatency: time.Second},
+			wantErr:   aiyou.ErrTimeout,
+			wantFault: FaultLatency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			defer s.Close()
+			s.OnAny().Reply(Text(longText))
+
+			chaos := NewChaos(nil, tt.config)
+			opts := []aiyou.Option{
+				aiyou.WithBaseURL(s.URL),
+				aiyou.WithTransport(chaos),
+				aiyou.WithStream(tt.stream),
+			}
+			if tt.wantFault == FaultLatency {
+				opts = append(opts, aiyou.WithDeadline(time.Millisecond))
+			}
+			_, err := aiyou.Completion(testModel, "test-token", "Hello", opts...)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if chaos.Faults()[tt.wantFault] != 1 {
+				t.Errorf("expected one %s fault, got %v (error: %v)", tt.wantFault, chaos.Faults(), err)
+			}
+		})
+	}
+}
+
+func TestChaosRetries(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.OnAny().Reply(Text("ok"))
+
+	chaos := NewChaos(nil, ChaosConfig{Seed: 42, ResetRate: 0.3, StatusRate: 0.3})
+	var succeeded int
+	for i := 0; i < 20; i++ {
+		got, err := aiyou.Completion(testModel, "test-token", "Hello",
+			aiyou.WithBaseURL(s.URL),
+			aiyou.WithTransport(chaos),
+			aiyou.WithRetry(5, time.Millisecond),
+		)
+		if err == nil && got == "ok" {
+			succeeded++
+		}
+	}
+	faults := chaos.Faults()
+	if faults[FaultReset] == 0 || faults[FaultStatus] == 0 {
+		t.Errorf("expected injected faults, got %v", faults)
+	}
+	if succeeded < 18 {
+		t.Errorf("expected retries to absorb most faults, %d/20 succeeded", succeeded)
+	}
+}
+
+func TestChaosDeterministic(t *testing.T) {
+	sequence := func() string {
+		chaos := NewChaos(nil, ChaosConfig{Seed: 7, ResetRate: 0.5, StatusRate: 0.5, CorruptRate: 0.5})
+		var plans []string
+		for i := 0; i < 20; i++ {
+			plans = append(plans, fmt.Sprintf("%+v", chaos.draw()))
+		}
+		return strings.Join(plans, "\n")
+	}
+	if a, b := sequence(), sequence(); !reflect.DeepEqual(a, b) {
+		t.Errorf("expected the same fault sequence for the same seed")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyoutest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	aiyou "github.com/n1neT10ne/aiyou-go-sdk"
+)
+
+// FakeModelName est le modèle indiqué dans les résultats de FakeChatModel
+const FakeModelName = "fake-model"
+
+// FakeChatModel est une implémentation déterministe de aiyou.ChatModel, en
+// mémoire et sans HTTP. Les réponses scriptées sont renvoyées dans l'ordre ;
+// une fois épuisées (ou s'il n'y en a pas), le message reçu est renvoyé en
+// écho. Stream transmet la réponse caractère par caractère. Les options des
+// appels sont ignorées.
+type FakeChatModel struct {
+	// Replies sont les réponses scriptées, renvoyées dans l'ordre
+	Replies []string
+
+	// Err, s'il est défini, est retourné par tous les appels
+	Err error
+
+	// Models sont les modèles retournés par ListModels
+	Models []string
+
+	mu       sync.Mutex
+	next     int
+	messages []string
+}
+
+var _ aiyou.ChatModel = (*FakeChatModel)(nil)
+
+// NewFakeChatModel crée un modèle renvoyant les réponses données dans
+// l'ordre, puis le message reçu en écho
+func NewFakeChatModel(replies ...string) *FakeChatModel {
+	return &FakeChatModel{Replies: replies}
+}
+
+// Messages retourne les messages reçus, dans l'ordre
+func (f *FakeChatModel) Messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.messages...)
+}
+
+// reply enregistre le message et retourne la réponse à renvoyer
+func (f *FakeChatModel) reply(message string) (string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, message)
+	n := len(f.messages)
+	if f.next < len(f.Replies) {
+		f.next++
+		return f.Replies[f.next-1], n
+	}
+	return message, n
+}
+
+// result construit le résultat d'un appel
+func (f *FakeChatModel) result(message, content string, n int) *aiyou.Result {
+	choice := aiyou.Choice{Role: "assistant", Content: content, FinishReason: aiyou.FinishReasonStop}
+	prompt, completion := len(strings.Fields(message)), len(strings.Fields(content))
+	return &aiyou.Result{
+		ID:           fmt.Sprintf("fake-%d", n),
+		Model:        FakeModelName,
+		Role:         choice.Role,
+		Content:      content,
+		FinishReason: choice.FinishReason,
+		Choices:      []aiyou.Choice{choice},
+		Usage: aiyou.Usage{
+			PromptTokens:     prompt,
+			CompletionTokens: completion,
+			TotalTokens:      prompt + completion,
+		},
+	}
+}
+
+// Chat implémente aiyou.ChatModel
+func (f *FakeChatModel) Chat(ctx context.Context, message string, opts ...aiyou.Option) (*aiyou.Result, error) {
+	if err := f.check(ctx, message); err != nil {
+		return nil, err
+	}
+	content, n := f.reply(message)
+	return f.result(message, content, n), nil
+}
+
+// Stream implémente aiyou.ChatModel, en transmettant la réponse caractère par
+// caractère. En cas d'annulation, le résultat partiel est retourné avec
+// l'erreur du contexte.
+func (f *FakeChatModel) Stream(ctx context.Context, message string, onChunk func(content string), opts ...aiyou.Option) (*aiyou.Result, error) {
+	if err := f.check(ctx, message); err != nil {
+		return nil, err
+	}
+	content, n := f.reply(message)
+
+	var sent strings.Builder
+	for _, r := range content {
+		if err := ctx.Err(); err != nil {
+			return f.result(message, sent.String(), n), err
+		}
+		sent.WriteRune(r)
+		if onChunk != nil {
+			onChunk(string(r))
+		}
+	}
+	return f.result(message, content, n), nil
+}
+
+// ListModels implémente aiyou.ChatModel
+func (f *FakeChatModel) ListModels(ctx context.Context) ([]aiyou.Model, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	models := make([]aiyou.Model, len(f.Models))
+	for i, name := range f.Models {
+		models[i] = aiyou.Model{Name: name}
+	}
+	return models, nil
+}
+
+// check valide un appel comme le client réel
+func (f *FakeChatModel) check(ctx context.Context, message string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if message == "" {
+		return aiyou.ErrEmptyMessage
+	}
+	return f.Err
+}
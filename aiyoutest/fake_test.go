@@ -0,0 +1,138 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyoutest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	aiyou "github.com/n1neT10ne/aiyou-go-sdk"
+)
+
+// summarize est un exemple de code applicatif dépendant de l'interface
+func summarize(ctx context.Context, model aiyou.ChatModel, text string) (string, error) {
+	result, err := model.Chat(ctx, "Summarize: "+text)
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+func TestFakeChatModel(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeChatModel("first", "second")
+
+	for _, want := range []string{"first", "second", "Summarize: echo"} {
+		got, err := summarize(ctx, fake, "echo")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+	if got := fake.Messages(); len(got) != 3 || got[0] != "Summarize: echo" {
+		t.Errorf("unexpected messages %v", got)
+	}
+
+	fake.Err = aiyou.ErrRateLimit
+	if _, err := summarize(ctx, fake, "text"); !errors.Is(err, aiyou.ErrRateLimit) {
+		t.Errorf("expected scripted error, got %v", err)
+	}
+	if _, err := NewFakeChatModel().Chat(ctx, ""); !errors.Is(err, aiyou.ErrEmptyMessage) {
+		t.Errorf("expected ErrEmptyMessage, got %v", err)
+	}
+}
+
+func TestFakeChatModelStream(t *testing.T) {
+	fake := NewFakeChatModel("héllo")
+	var chunks []string
+	result, err := fake.Stream(context.Background(), "Hi", func(c string) { chunks = append(chunks, c) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(chunks, "|") != "h|é|l|l|o" || result.Content != "héllo" {
+		t.Errorf("unexpected stream %v / %q", chunks, result.Content)
+	}
+
+	// Annulation en cours de stream : résultat partiel
+	ctx, cancel := context.WithCancel(context.Background())
+	fake = NewFakeChatModel("abcdef")
+	result, err = fake.Stream(ctx, "Hi", func(c string) {
+		if c == "c" {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) || result.Content != "abc" {
+		t.Errorf("expected partial result abc with context.Canceled, got %q / %v", result.Content, err)
+	}
+}
+
+func TestClientImplementsChatModel(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetModels("az-gpt-4o")
+	s.OnAny().Reply(Text("Bonjour tout le monde"))
+
+	var model aiyou.ChatModel = aiyou.NewClient(testModel, "test-token", aiyou.WithBaseURL(s.URL))
+	ctx := context.Background()
+
+	got, err := summarize(ctx, model, "text")
+	if err != nil || got != "Bonjour tout le monde" {
+		t.Fatalf("unexpected chat result %q: %v", got, err)
+	}
+
+	var chunks []string
+	result, err := model.Stream(ctx, "Hello", func(c string) { chunks = append(chunks, c) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 4 || strings.Join(chunks, "") != result.Content {
+		t.Errorf("unexpected chunks %q for %q", chunks, result.Content)
+	}
+	if req, _ := s.LastRequest(); !req.Stream {
+		t.Error("expected a streaming request")
+	}
+
+	models, err := model.ListModels(ctx)
+	if err != nil || len(models) != 1 {
+		t.Errorf("unexpected models %v: %v", models, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := model.Chat(canceled, "Hello"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClientStreamChoicesAutoContinue(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.OnAny().Reply(
+		Response{Content: "Hello ", FinishReason: aiyou.FinishReasonLength},
+		Text("there"),
+		Text("friend"),
+	)
+
+	client := aiyou.NewClient(testModel, "test-token", aiyou.WithBaseURL(s.URL))
+	var streamed strings.Builder
+	result, err := client.Stream(context.Background(), "Hello", func(c string) { streamed.WriteString(c) },
+		aiyou.WithN(2), aiyou.WithAutoContinue(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.AssertRequestCount(t, 3)
+
+	if len(result.Choices) != 2 || result.Choices[0].Content != "Hello there" || result.Choices[1].Content != "Hello friend" {
+		t.Fatalf("unexpected choices %+v", result.Choices)
+	}
+	if streamed.String() != result.Choices[0].Content {
+		t.Errorf("expected streamed content %q, got %q", result.Choices[0].Content, streamed.String())
+	}
+}
@@ -0,0 +1,469 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+// Package aiyoutest fournit un faux serveur AI.You en mémoire, pour tester
+// le code qui utilise le SDK sans accès réseau ni token.
+//
+//	srv := aiyoutest.NewServer()
+//	defer srv.Close()
+//	srv.OnModel("az-gpt-4o").Reply(aiyoutest.Status(503), aiyoutest.Text("Bonjour"))
+//
+//	got, err := aiyou.Completion("az-gpt-4o", "token", "Hello",
+//		aiyou.WithBaseURL(srv.URL), aiyou.WithRetry(1, time.Millisecond))
+//	srv.AssertRequestCount(t, 2)
+package aiyoutest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	aiyou "github.com/n1neT10ne/aiyou-go-sdk"
+)
+
+// Server est un faux serveur AI.You implémentant /models et /chat/completions
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	models   []string
+	rules    []*Rule
+	requests []Request
+	ids      int
+}
+
+// Request est une requête reçue par le faux serveur
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+
+	// Champs décodés d'une requête de complétion
+	Model        string
+	Prompt       string
+	SystemPrompt string
+	Temperature  float64
+	N            int
+	Stream       bool
+}
+
+// Response est une réponse scriptée
+type Response struct {
+	// Content est le contenu de chaque choix
+	Content string
+
+	// FinishReason est la raison d'arrêt (« stop » par défaut)
+	FinishReason string
+
+	// Usage remplace la consommation calculée (un token par mot)
+	Usage *aiyou.Usage
+
+	// Status, s'il est défini et différent de 200, renvoie une erreur HTTP
+	Status int
+
+	// RetryAfter est envoyé dans l'en-tête Retry-After
+	RetryAfter time.Duration
+
+	// Body remplace le corps de la réponse
+	Body string
+
+	// Chunks sont les fragments du stream (par défaut, Content découpé par mot)
+	Chunks []string
+
+	// ChunkDelay est le délai avant chaque fragment du stream
+	ChunkDelay time.Duration
+
+	// Malformed envoie une ligne SSE invalide après le premier fragment
+	Malformed bool
+}
+
+// Text retourne une réponse avec le contenu donné
+func Text(content string) Response {
+	return Response{Content: content}
+}
+
+// Status retourne une réponse d'erreur HTTP
+func Status(code int) Response {
+	return Response{Status: code, Body: http.StatusText(code)}
+}
+
+// Unauthorized retourne une réponse 401
+func Unauthorized() Response {
+	return Status(http.StatusUnauthorized)
+}
+
+// RateLimited retourne une réponse 429 avec l'en-tête Retry-After
+func RateLimited(retryAfter time.Duration) Response {
+	r := Status(http.StatusTooManyRequests)
+	r.RetryAfter = retryAfter
+	return r
+}
+
+// ServerError retourne une réponse 500
+func ServerError() Response {
+	return Status(http.StatusInternalServerError)
+}
+
+// MalformedStream retourne un stream dont le second événement est invalide
+func MalformedStream(content string) Response {
+	return Response{Content: content, Malformed: true}
+}
+
+// SlowStream retourne un stream dont chaque fragment est envoyé après delay
+func SlowStream(content string, delay time.Duration) Response {
+	return Response{Content: content, ChunkDelay: delay}
+}
+
+// Rule associe des réponses scriptées aux requêtes correspondantes. Les
+// réponses sont renvoyées dans l'ordre, la dernière étant répétée.
+type Rule struct {
+	model     string
+	prompt    *regexp.Regexp
+	responses []Response
+	calls     int
+}
+
+// Reply définit les réponses de la règle
+func (r *Rule) Reply(responses ...Response) *Rule {
+	r.responses = append(r.responses, responses...)
+	return r
+}
+
+// matches indique si la règle s'applique à la requête
+func (r *Rule) matches(req *Request) bool {
+	if r.model != "" && r.model != req.Model {
+		return false
+	}
+	return r.prompt == nil || r.prompt.MatchString(req.Prompt)
+}
+
+// next retourne la prochaine réponse de la règle
+func (r *Rule) next() Response {
+	i := r.calls
+	if i >= len(r.responses) {
+		i = len(r.responses) - 1
+	}
+	r.calls++
+	return r.responses[i]
+}
+
+// NewServer démarre un faux serveur. Sans règle correspondante, une
+// complétion renvoie le prompt reçu (écho).
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetModels définit les modèles renvoyés par /models
+func (s *Server) SetModels(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = append([]string(nil), names...)
+}
+
+// OnModel ajoute une règle pour les requêtes du modèle donné
+func (s *Server) OnModel(model string) *Rule {
+	return s.addRule(&Rule{model: model})
+}
+
+// OnPrompt ajoute une règle pour les requêtes dont le prompt correspond à
+// l'expression régulière donnée
+func (s *Server) OnPrompt(pattern string) *Rule {
+	return s.addRule(&Rule{prompt: regexp.MustCompile(pattern)})
+}
+
+// OnAny ajoute une règle pour toutes les requêtes de complétion
+func (s *Server) OnAny() *Rule {
+	return s.addRule(&Rule{})
+}
+
+// addRule enregistre une règle ; les règles sont évaluées dans l'ordre d'ajout
+func (s *Server) addRule(r *Rule) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, r)
+	return r
+}
+
+// Requests retourne les requêtes reçues, dans l'ordre
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// LastRequest retourne la dernière requête reçue
+func (s *Server) LastRequest() (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return Request{}, false
+	}
+	return s.requests[len(s.requests)-1], true
+}
+
+// AssertRequestCount vérifie le nombre de requêtes reçues
+func (s *Server) AssertRequestCount(t testing.TB, want int) {
+	t.Helper()
+	if got := len(s.Requests()); got != want {
+		t.Errorf("aiyoutest: expected %d requests, got %d", want, got)
+	}
+}
+
+// AssertPrompt vérifie le prompt de la dernière requête reçue
+func (s *Server) AssertPrompt(t testing.TB, want string) {
+	t.Helper()
+	req, ok := s.LastRequest()
+	if !ok {
+		t.Errorf("aiyoutest: expected prompt %q, no request received", want)
+		return
+	}
+	if req.Prompt != want {
+		t.Errorf("aiyoutest: expected prompt %q, got %q", want, req.Prompt)
+	}
+}
+
+// AssertHeader vérifie un en-tête de la dernière requête reçue
+func (s *Server) AssertHeader(t testing.TB, key, want string) {
+	t.Helper()
+	req, ok := s.LastRequest()
+	if !ok {
+		t.Errorf("aiyoutest: expected header %s=%q, no request received", key, want)
+		return
+	}
+	if got := req.Header.Get(key); got != want {
+		t.Errorf("aiyoutest: expected header %s=%q, got %q", key, want, got)
+	}
+}
+
+// completionRequest est le corps d'une requête de complétion
+type completionRequest struct {
+	Messages []struct {
+		Role    string `json:"role"`
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"messages"`
+	Model         string  `json:"model"`
+	Temperature   float64 `json:"temperature"`
+	N             int     `json:"n"`
+	Stream        bool    `json:"stream"`
+	PromptSystem  string  `json:"promptSystem"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+// handle traite une requête
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body}
+
+	var creq completionRequest
+	if r.URL.Path == "/chat/completions" {
+		if err := json.Unmarshal(body, &creq); err != nil {
+			s.record(req)
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		req.Model, req.Temperature, req.N = creq.Model, creq.Temperature, creq.N
+		req.Stream, req.SystemPrompt = creq.Stream, creq.PromptSystem
+		for _, m := range creq.Messages {
+			if m.Role == "user" && len(m.Content) > 0 {
+				req.Prompt = m.Content[0].Text
+			}
+		}
+	}
+	s.record(req)
+
+	switch r.URL.Path {
+	case "/models":
+		s.serveModels(w)
+	case "/chat/completions":
+		resp, id := s.script(&req)
+		s.serveCompletion(w, r, &req, &creq, resp, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// record enregistre une requête reçue
+func (s *Server) record(req Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+}
+
+// script retourne la réponse scriptée de la requête et un identifiant unique
+func (s *Server) script(req *Request) (Response, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids++
+	id := fmt.Sprintf("chatcmpl-fake-%d", s.ids)
+	for _, rule := range s.rules {
+		if len(rule.responses) > 0 && rule.matches(req) {
+			return rule.next(), id
+		}
+	}
+	return Text(req.Prompt), id
+}
+
+// serveModels renvoie la liste des modèles
+func (s *Server) serveModels(w http.ResponseWriter) {
+	s.mu.Lock()
+	models := make([]map[string]string, len(s.models))
+	for i, name := range s.models {
+		models[i] = map[string]string{"name": name}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode([]map[string]any{{"models": models}})
+}
+
+// serveCompletion renvoie la réponse scriptée d'une complétion
+func (s *Server) serveCompletion(w http.ResponseWriter, r *http.Request, req *Request, creq *completionRequest, resp Response, id string) {
+	if resp.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((resp.RetryAfter+time.Second-1)/time.Second)))
+	}
+	if resp.Status != 0 && resp.Status != http.StatusOK {
+		http.Error(w, resp.Body, resp.Status)
+		return
+	}
+	if resp.Body != "" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, resp.Body)
+		return
+	}
+
+	finish := resp.FinishReason
+	if finish == "" {
+		finish = aiyou.FinishReasonStop
+	}
+	usage := aiyou.Usage{
+		PromptTokens:     countTokens(req.Prompt) + countTokens(req.SystemPrompt),
+		CompletionTokens: countTokens(resp.Content) * max(req.N, 1),
+	}
+	if resp.Usage != nil {
+		usage = *resp.Usage
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	if req.Stream {
+		includeUsage := creq.StreamOptions != nil && creq.StreamOptions.IncludeUsage
+		s.serveStream(w, r, req, resp, id, finish, usage, includeUsage)
+		return
+	}
+
+	choices := make([]map[string]any, max(req.N, 1))
+	for i := range choices {
+		choices[i] = map[string]any{
+			"index":         i,
+			"message":       map[string]string{"role": "assistant", "content": resp.Content},
+			"finish_reason": finish,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      id,
+		"object":  "chat.completion",
+		"model":   req.Model,
+		"choices": choices,
+		"usage":   usage,
+	})
+}
+
+// serveStream renvoie la réponse scriptée sous forme de stream SSE
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, req *Request, resp Response, id, finish string, usage aiyou.Usage, includeUsage bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		// En-têtes envoyés avant le premier fragment, comme un serveur réel
+		flusher.Flush()
+	}
+
+	event := 0
+	send := func(data any) bool {
+		if resp.ChunkDelay > 0 {
+			select {
+			case <-time.After(resp.ChunkDelay):
+			case <-r.Context().Done():
+				return false
+			}
+		}
+		encoded, _ := json.Marshal(data)
+		event++
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event, encoded)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+	chunk := func(index int, delta map[string]string, finishReason any) map[string]any {
+		return map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"model":   req.Model,
+			"choices": []map[string]any{{"index": index, "delta": delta, "finish_reason": finishReason}},
+		}
+	}
+
+	chunks := resp.Chunks
+	if chunks == nil {
+		chunks = splitWords(resp.Content)
+	}
+	for i := 0; i < max(req.N, 1); i++ {
+		for j, c := range chunks {
+			if !send(chunk(i, map[string]string{"content": c}, nil)) {
+				return
+			}
+			if resp.Malformed && j == 0 {
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":\n\n")
+				return
+			}
+		}
+		if !send(chunk(i, map[string]string{}, finish)) {
+			return
+		}
+	}
+	if includeUsage {
+		if !send(map[string]any{"id": id, "model": req.Model, "choices": []any{}, "usage": usage}) {
+			return
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// splitWords découpe un texte en fragments d'un mot, espaces inclus
+func splitWords(s string) []string {
+	var chunks []string
+	for len(s) > 0 {
+		i := strings.IndexByte(s, ' ')
+		if i < 0 {
+			chunks = append(chunks, s)
+			break
+		}
+		chunks = append(chunks, s[:i+1])
+		s = s[i+1:]
+	}
+	return chunks
+}
+
+// countTokens compte un token par mot
+func countTokens(s string) int {
+	return len(strings.Fields(s))
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyoutest
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	aiyou "github.com/n1neT10ne/aiyou-go-sdk"
+)
+
+const testModel = "az-gpt-4o"
+
+func TestServerCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  func(s *Server)
+		opts    []aiyou.Option
+		prompt  string
+		want    string
+		wantErr error
+		wantN   int
+	}{
+		{
+			name:   "echo by default",
+			prompt: "Hello there",
+			want:   "Hello there",
+			wantN:  1,
+		},
+		{
+			name:   "scripted per model",
+			script: func(s *Server) { s.OnModel(testModel).Reply(Text("Bonjour")) },
+			prompt: "Hello",
+			want:   "Bonjour",
+			wantN:  1,
+		},
+		{
+			name: "scripted per prompt",
+			script: func(s *Server) {
+				s.OnPrompt(`(?i)weather`).Reply(Text("Sunny"))
+				s.OnAny().Reply(Text("Unknown"))
+			},
+			prompt: "What's the weather?",
+			want:   "Sunny",
+			wantN:  1,
+		},
+		{
+			name:   "streamed",
+			script: func(s *Server) { s.OnAny().Reply(Text("one two three")) },
+			opts:   []aiyou.Option{aiyou.WithStream(true)},
+			prompt: "Count",
+			want:   "one two three",
+			wantN:  1,
+		},
+		{
+			name:   "retried server error",
+			script: func(s *Server) { s.OnAny().Reply(ServerError(), RateLimited(time.Second), Text("ok")) },
+			opts:   []aiyou.Option{aiyou.WithRetry(2, time.Millisecond)},
+			prompt: "Hello",
+			want:   "ok",
+			wantN:  3,
+		},
+		{
+			name:    "unauthorized",
+			script:  func(s *Server) { s.OnAny().Reply(Unauthorized()) },
+			prompt:  "Hello",
+			wantErr: aiyou.ErrInvalidToken,
+			wantN:   1,
+		},
+		{
+			name:    "malformed stream",
+			script:  func(s *Server) { s.OnAny().Reply(MalformedStream("partial answer")) },
+			opts:    []aiyou.Option{aiyou.WithStream(true)},
+			prompt:  "Hello",
+			want:    "partial ",
+			wantErr: aiyou.ErrStreamCorrupted,
+			wantN:   1,
+		},
+		{
+			name:    "slow stream",
+			script:  func(s *Server) { s.OnAny().Reply(SlowStream("too slow", 200*time.Millisecond)) },
+			opts:    []aiyou.Option{aiyou.WithStream(true), aiyou.WithFirstTokenTimeout(50 * time.Millisecond)},
+			prompt:  "Hello",
+			wantErr: aiyou.ErrTimeout,
+			wantN:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			defer s.Close()
+			if tt.script != nil {
+				tt.script(s)
+			}
+
+			opts := append([]aiyou.Option{aiyou.WithBaseURL(s.URL)}, tt.opts...)
+			got, err := aiyou.Completion(testModel, "test-token", tt.prompt, opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			s.AssertRequestCount(t, tt.wantN)
+			s.AssertPrompt(t, tt.prompt)
+		})
+	}
+}
+
+func TestServerResult(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.OnAny().Reply(Response{Content: "a b", FinishReason: aiyou.FinishReasonLength})
+
+	for _, stream := range []bool{false, true} {
+		result, err := aiyou.CompletionWithResult(testModel, "test-token", "Hello world",
+			aiyou.WithBaseURL(s.URL),
+			aiyou.WithStream(stream),
+			aiyou.WithStreamUsage(true),
+			aiyou.WithN(2),
+			aiyou.WithSystemPrompt("Be brief"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Choices) != 2 || result.Choices[1].Content != "a b" || result.FinishReason != aiyou.FinishReasonLength {
+			t.Errorf("stream=%v: unexpected result %+v", stream, result)
+		}
+		if result.Usage.PromptTokens != 4 || result.Usage.CompletionTokens != 4 || result.UsageEstimated {
+			t.Errorf("stream=%v: unexpected usage %+v", stream, result.Usage)
+		}
+		req, _ := s.LastRequest()
+		if req.SystemPrompt != "Be brief" || req.N != 2 || req.Stream != stream {
+			t.Errorf("unexpected decoded request %+v", req)
+		}
+	}
+	s.AssertHeader(t, "Authorization", "Bearer test-token")
+}
+
+func TestServerModels(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetModels("model-a", "model-b")
+
+	models, err := aiyou.ListModels("test-token", aiyou.WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(models) != 2 || models[1].Name != "model-b" {
+		t.Errorf("unexpected models %+v", models)
+	}
+
+	resp, err := http.Get(s.URL + "/unknown")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.OnAny().Reply(RateLimited(1500 * time.Millisecond))
+
+	_, err := aiyou.Completion(testModel, "test-token", "Hello", aiyou.WithBaseURL(s.URL))
+	if !errors.Is(err, aiyou.ErrRateLimit) {
+		t.Fatalf("expected ErrRateLimit, got %v", err)
+	}
+	// La réponse 429 porte l'en-tête Retry-After arrondi à la seconde supérieure
+	resp, err := http.Post(s.URL+"/chat/completions", "application/json", strings.NewReader(`{"model":"m"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After 2, got %q", got)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord est une ligne du journal d'audit : un appel de complétion
+type AuditRecord struct {
+	Time         time.Time      `json:"time"`
+	Model        string         `json:"model"`
+	Options      AuditOptions   `json:"options"`
+	Messages     []AuditMessage `json:"messages"`
+	Response     string         `json:"response"`
+	FinishReason string         `json:"finish_reason,omitempty"`
+	Usage        Usage          `json:"usage"`
+	LatencyMS    int64          `json:"latency_ms"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// AuditOptions sont les options d'un appel qui influencent la réponse
+type AuditOptions struct {
+	Temperature  float64 `json:"temperature"`
+	PromptSystem string  `json:"system_prompt,omitempty"`
+	N            int     `json:"n,omitempty"`
+	Stream       bool    `json:"stream,omitempty"`
+	AssistantID  string  `json:"assistant_id,omitempty"`
+}
+
+// AuditMessage est un message envoyé au modèle
+type AuditMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// AuditLog écrit un enregistrement JSON par ligne et par appel. Il peut être
+// partagé entre appels concurrents.
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	// Rotation, pour les journaux ouverts avec OpenAuditLog
+	file       *os.File
+	path       string
+	size       int64
+	maxSize    int64
+	maxBackups int
+}
+
+// NewAuditLog crée un journal d'audit écrivant dans w
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// OpenAuditLog ouvre (ou crée) un journal d'audit dans le fichier path, en
+// mode ajout. Quand le fichier dépasse maxSize octets, il est renommé en
+// path.1 (les sauvegardes existantes étant décalées) et un nouveau fichier
+// est ouvert ; seules maxBackups sauvegardes sont conservées. Un maxSize nul
+// désactive la rotation.
+func OpenAuditLog(path string, maxSize int64, maxBackups int) (*AuditLog, error) {
+	if maxSize < 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("%w: audit log rotation limits cannot be negative", ErrInvalidOption)
+	}
+	l := &AuditLog{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open ouvre le fichier du journal
+func (l *AuditLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	l.file, l.w, l.size = f, f, info.Size()
+	return nil
+}
+
+// rotate décale les sauvegardes et rouvre un fichier vide
+func (l *AuditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("error rotating audit log: %w", err)
+	}
+	if l.maxBackups == 0 {
+		if err := os.Remove(l.path); err != nil {
+			return fmt.Errorf("error rotating audit log: %w", err)
+		}
+		return l.open()
+	}
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxBackups))
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return fmt.Errorf("error rotating audit log: %w", err)
+	}
+	return l.open()
+}
+
+// Write ajoute un enregistrement au journal
+func (l *AuditLog) Write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil && l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.w.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing audit record: %w", err)
+	}
+	return nil
+}
+
+// Close ferme le fichier du journal ouvert avec OpenAuditLog
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// newAuditRecord crée l'enregistrement d'audit d'un appel
+func newAuditRecord(model, message string, options *Options, start time.Time, result *Result, err error) AuditRecord {
+	record := AuditRecord{
+		Time:  start.UTC(),
+		Model: model,
+		Options: AuditOptions{
+			Temperature:  float64(options.Temperature),
+			PromptSystem: options.PromptSystem,
+			N:            options.N,
+			Stream:       options.Stream,
+			AssistantID:  options.AssistantID,
+		},
+		Messages:  []AuditMessage{{Role: "user", Content: message}},
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	if result != nil {
+		record.Response = result.Content
+		record.FinishReason = result.FinishReason
+		record.Usage = result.Usage
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// ReadAuditLog lit les enregistrements d'un journal d'audit
+func ReadAuditLog(r io.Reader) ([]AuditRecord, error) {
+	var records []AuditRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return records, fmt.Errorf("error decoding audit record at line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("error reading audit log: %w", err)
+	}
+	return records, nil
+}
+
+// ReplayResult est le résultat du rejeu d'un enregistrement d'audit
+type ReplayResult struct {
+	// Record est l'enregistrement rejoué
+	Record AuditRecord
+
+	// Response est la nouvelle réponse
+	Response string
+
+	// Err est l'erreur du rejeu
+	Err error
+
+	// Changed indique que la réponse diffère de celle enregistrée
+	Changed bool
+
+	// Diff est la différence ligne à ligne entre l'ancienne et la nouvelle
+	// réponse (vide si elles sont identiques)
+	Diff string
+}
+
+// Replay rejoue les enregistrements d'audit avec le modèle donné (celui de
+// l'enregistrement s'il est vide) et compare les réponses. Les options
+// enregistrées (température, prompt système, n, assistant) sont appliquées
+// avant opts, qui peuvent donc les remplacer. Les enregistrements sont
+// rejoués séquentiellement ; une erreur n'est retournée que si tous les
+// rejeux ont échoué.
+func Replay(records []AuditRecord, model string, token string, opts ...Option) ([]ReplayResult, error) {
+	results := make([]ReplayResult, len(records))
+	var errs []error
+	for i, record := range records {
+		results[i] = replayRecord(record, model, token, opts)
+		if results[i].Err != nil {
+			errs = append(errs, results[i].Err)
+		}
+	}
+	if len(records) > 0 && len(errs) == len(records) {
+		return results, fmt.Errorf("all replays failed: %w", errors.Join(errs...))
+	}
+	return results, nil
+}
+
+// replayRecord rejoue un enregistrement d'audit
+func replayRecord(record AuditRecord, model string, token string, opts []Option) ReplayResult {
+	if model == "" {
+		model = record.Model
+	}
+	message := ""
+	for _, m := range record.Messages {
+		if m.Role == "user" {
+			message = m.Content
+		}
+	}
+
+	recorded := []Option{WithTemperature(record.Options.Temperature)}
+	if record.Options.PromptSystem != "" {
+		recorded = append(recorded, WithSystemPrompt(record.Options.PromptSystem))
+	}
+	if record.Options.N > 0 {
+		recorded = append(recorded, WithN(record.Options.N))
+	}
+	if record.Options.AssistantID != "" {
+		recorded = append(recorded, WithAssistantID(record.Options.AssistantID))
+	}
+
+	result, err := CompletionWithResult(model, token, message, append(recorded, opts...)...)
+	replay := ReplayResult{Record: record, Err: err}
+	if result != nil {
+		replay.Response = result.Content
+	}
+	if replay.Response != record.Response {
+		replay.Changed = true
+		replay.Diff = diffLines(record.Response, replay.Response)
+	}
+	return replay
+}
+
+// diffLines retourne la différence ligne à ligne entre deux textes : les
+// lignes supprimées sont préfixées par "- ", les lignes ajoutées par "+ " et
+// les lignes communes par "  "
+func diffLines(before, after string) string {
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+
+	// Plus longue sous-séquence commune
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Fail") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"Bonjour"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	log := NewAuditLog(&buf)
+	opts := []Option{WithBaseURL(server.URL), WithAuditLog(log), WithTemperature(0.2), WithSystemPrompt("Translate")}
+	if _, err := Completion(modelNonStream, "test-token", "Hello", opts...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	Completion(modelNonStream, "test-token", "Fail", append(opts, WithHeader("X-Fail", "1"))...)
+
+	if strings.Contains(buf.String(), "test-token") {
+		t.Errorf("audit log must not contain the token: %s", buf.String())
+	}
+	records, err := ReadAuditLog(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	ok := records[0]
+	if ok.Model != modelNonStream || ok.Response != "Bonjour" || ok.FinishReason != "stop" || ok.Error != "" {
+		t.Errorf("unexpected record: %+v", ok)
+	}
+	if ok.Options.Temperature != 0.2 || ok.Options.PromptSystem != "Translate" {
+		t.Errorf("unexpected options: %+v", ok.Options)
+	}
+	if len(ok.Messages) != 1 || ok.Messages[0] != (AuditMessage{Role: "user", Content: "Hello"}) {
+		t.Errorf("unexpected messages: %+v", ok.Messages)
+	}
+	if ok.Usage.PromptTokens != 3 || ok.Time.IsZero() {
+		t.Errorf("unexpected usage or time: %+v", ok)
+	}
+	if records[1].Error != ErrInvalidToken.Error() {
+		t.Errorf("expected error in record, got %q", records[1].Error)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	// Deux enregistrements par fichier
+	line, _ := json.Marshal(AuditRecord{Model: "model-0"})
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := OpenAuditLog(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := log.Write(AuditRecord{Model: fmt.Sprintf("model-%d", i)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	models := func(name string) []string {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer f.Close()
+		records, err := ReadAuditLog(f)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var names []string
+		for _, r := range records {
+			names = append(names, r.Model)
+		}
+		return names
+	}
+
+	for name, want := range map[string]string{
+		path:        "[model-4]",
+		path + ".1": "[model-2 model-3]",
+		path + ".2": "[model-0 model-1]",
+	} {
+		if got := fmt.Sprint(models(name)); got != want {
+			t.Errorf("%s: expected %s, got %s", filepath.Base(name), want, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, got %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var systems []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Model        string `json:"model"`
+			PromptSystem string `json:"promptSystem"`
+		}
+		json.Unmarshal(body, &req)
+		systems = append(systems, req.PromptSystem)
+		fmt.Fprintf(w, `{"choices":[{"message":{"content":"line 1\nfrom %s"}}]}`, req.Model)
+	}))
+	defer server.Close()
+
+	records := []AuditRecord{
+		{Model: "old-model", Options: AuditOptions{Temperature: 0.5, PromptSystem: "Be brief"},
+			Messages: []AuditMessage{{Role: "user", Content: "Hi"}}, Response: "line 1\nfrom old-model"},
+		{Model: "old-model", Options: AuditOptions{Temperature: 0.5},
+			Messages: []AuditMessage{{Role: "user", Content: "Hi"}}, Response: "line 1\nfrom new-model"},
+	}
+	results, err := Replay(records, "new-model", "test-token", WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !results[0].Changed || results[0].Diff != "  line 1\n- from old-model\n+ from new-model\n" {
+		t.Errorf("unexpected diff: %q", results[0].Diff)
+	}
+	if results[1].Changed || results[1].Diff != "" {
+		t.Errorf("expected unchanged response, got %+v", results[1])
+	}
+	if systems[0] != "Be brief" {
+		t.Errorf("expected recorded system prompt to be replayed, got %q", systems[0])
+	}
+}
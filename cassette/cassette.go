@@ -0,0 +1,361 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+// Package cassette fournit un transport HTTP qui enregistre les échanges
+// réels avec l'API AI.You dans un fichier (une « cassette »), puis les rejoue
+// hors ligne, pour des tests déterministes.
+//
+//	rec, err := cassette.New("testdata/completion.json", cassette.ModeReplay)
+//	...
+//	aiyou.Completion(model, token, message, aiyou.WithTransport(rec))
+//
+// Le token d'authentification n'est jamais enregistré.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode est le mode de fonctionnement d'un Transport
+type Mode int
+
+const (
+	// ModeReplay rejoue les échanges de la cassette, sans accès réseau
+	ModeReplay Mode = iota
+
+	// ModeRecord transmet les requêtes au transport réel et enregistre les échanges
+	ModeRecord
+
+	// ModePassthrough transmet les requêtes au transport réel sans enregistrer
+	ModePassthrough
+)
+
+// ErrNoInteraction est retournée en rejeu quand aucun échange enregistré ne
+// correspond à la requête
+var ErrNoInteraction = errors.New("cassette: no matching interaction")
+
+// scrubbed remplace le token dans les échanges enregistrés
+const scrubbed = "[SCRUBBED]"
+
+// Cassette est le contenu d'un fichier de cassette
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction est un échange HTTP enregistré
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request est la partie d'une requête utilisée pour la correspondance
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+
+	// Body est le corps JSON normalisé (clés triées, sans espaces)
+	Body string `json:"body,omitempty"`
+}
+
+// Response est une réponse enregistrée
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+
+	// Body est le corps d'une réponse non streamée
+	Body string `json:"body,omitempty"`
+
+	// Chunks sont les fragments d'un stream SSE, dans l'ordre de réception
+	Chunks []Chunk `json:"chunks,omitempty"`
+}
+
+// Chunk est un fragment de stream SSE, reçu Delay après le précédent
+type Chunk struct {
+	Delay time.Duration `json:"delay_ns"`
+	Data  string        `json:"data"`
+}
+
+// Transport est un http.RoundTripper qui enregistre ou rejoue une cassette
+type Transport struct {
+	// Next est le transport réel des modes record et passthrough
+	// (http.DefaultTransport par défaut)
+	Next http.RoundTripper
+
+	// Timing rejoue les fragments de stream avec leurs délais d'origine
+	Timing bool
+
+	mode Mode
+	path string
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New crée un transport pour la cassette path. En mode replay, la cassette
+// est chargée immédiatement ; en mode record, elle est écrite par Save.
+func New(path string, mode Mode) (*Transport, error) {
+	t := &Transport{mode: mode, path: path}
+	if mode != ModeReplay {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: error loading %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &t.cassette); err != nil {
+		return nil, fmt.Errorf("cassette: error decoding %s: %w", path, err)
+	}
+	// Les cassettes éditées à la main ne sont pas forcément normalisées
+	for i := range t.cassette.Interactions {
+		r := &t.cassette.Interactions[i].Request
+		r.Body = normalizeJSON([]byte(r.Body))
+	}
+	t.used = make([]bool, len(t.cassette.Interactions))
+	return t, nil
+}
+
+// Interactions retourne une copie des échanges enregistrés ou chargés
+func (t *Transport) Interactions() []Interaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Interaction(nil), t.cassette.Interactions...)
+}
+
+// Save écrit les échanges enregistrés dans le fichier de la cassette (mode
+// record uniquement)
+func (t *Transport) Save() error {
+	if t.mode != ModeRecord {
+		return nil
+	}
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("cassette: error encoding: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return fmt.Errorf("cassette: error saving %s: %w", t.path, err)
+	}
+	if err := os.WriteFile(t.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("cassette: error saving %s: %w", t.path, err)
+	}
+	return nil
+}
+
+// RoundTrip implémente http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch t.mode {
+	case ModePassthrough:
+		return t.next().RoundTrip(req)
+	case ModeRecord:
+		return t.record(req)
+	default:
+		return t.replay(req)
+	}
+}
+
+// next retourne le transport réel
+func (t *Transport) next() http.RoundTripper {
+	if t.Next != nil {
+		return t.Next
+	}
+	return http.DefaultTransport
+}
+
+// record transmet la requête et enregistre l'échange. La réponse est lue
+// entièrement (avec la chronologie des fragments de stream) avant d'être
+// retournée.
+func (t *Transport) record(req *http.Request) (*http.Response, error) {
+	key, body, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	resp, err := t.next().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	token := bearerToken(req)
+	recorded := Response{StatusCode: resp.StatusCode, Header: resp.Header.Clone()}
+	recorded.Header.Del("Set-Cookie")
+
+	if isStream(resp) {
+		buf := make([]byte, 32*1024)
+		last := time.Now()
+		for {
+			n, rerr := resp.Body.Read(buf)
+			if n > 0 {
+				now := time.Now()
+				recorded.Chunks = append(recorded.Chunks, Chunk{
+					Delay: now.Sub(last),
+					Data:  scrub(string(buf[:n]), token),
+				})
+				last = now
+			}
+			if rerr == io.EOF {
+				break
+			}
+			if rerr != nil {
+				return nil, rerr
+			}
+		}
+	} else {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = scrub(string(data), token)
+	}
+	key.Body = scrub(key.Body, token)
+
+	t.mu.Lock()
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{Request: key, Response: recorded})
+	t.mu.Unlock()
+
+	return recorded.httpResponse(req, false), nil
+}
+
+// replay retourne le premier échange non encore rejoué correspondant à la requête
+func (t *Transport) replay(req *http.Request) (*http.Response, error) {
+	key, _, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, interaction := range t.cassette.Interactions {
+		if !t.used[i] && interaction.Request == key {
+			t.used[i] = true
+			return interaction.Response.httpResponse(req, t.Timing), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s %s", ErrNoInteraction, key.Method, key.Path, key.Body)
+}
+
+// httpResponse reconstruit la réponse HTTP enregistrée
+func (r Response) httpResponse(req *http.Request, timing bool) *http.Response {
+	var body io.ReadCloser
+	if r.Chunks != nil {
+		body = &chunkReader{req: req, chunks: r.Chunks, timing: timing}
+	} else {
+		body = io.NopCloser(strings.NewReader(r.Body))
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode: r.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     r.Header.Clone(),
+		Body:       body,
+		Request:    req,
+	}
+}
+
+// chunkReader rejoue les fragments d'un stream, avec leurs délais si timing est activé
+type chunkReader struct {
+	req     *http.Request
+	chunks  []Chunk
+	current []byte
+	timing  bool
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.current) == 0 {
+		if len(c.chunks) == 0 {
+			return 0, io.EOF
+		}
+		next := c.chunks[0]
+		c.chunks = c.chunks[1:]
+		if c.timing && next.Delay > 0 {
+			select {
+			case <-time.After(next.Delay):
+			case <-c.req.Context().Done():
+				return 0, c.req.Context().Err()
+			}
+		}
+		c.current = []byte(next.Data)
+	}
+	n := copy(p, c.current)
+	c.current = c.current[n:]
+	return n, nil
+}
+
+func (c *chunkReader) Close() error {
+	c.chunks = nil
+	return nil
+}
+
+// requestKey retourne la clé de correspondance de la requête et son corps
+func requestKey(req *http.Request) (Request, []byte, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return Request{}, nil, fmt.Errorf("cassette: error reading request body: %w", err)
+		}
+	}
+	return Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Body:   normalizeJSON(body),
+	}, body, nil
+}
+
+// normalizeJSON retourne un corps JSON sous forme canonique (clés triées,
+// sans espaces) ; un corps non JSON est retourné tel quel
+func normalizeJSON(body []byte) string {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return string(body)
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(normalized)
+}
+
+// bearerToken retourne le token de l'en-tête Authorization
+func bearerToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return auth[len("Bearer "):]
+	}
+	return ""
+}
+
+// scrub remplace le token dans un texte enregistré
+func scrub(s, token string) string {
+	if token == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, token, scrubbed)
+}
+
+// isStream indique si la réponse est un stream SSE
+func isStream(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package cassette_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	aiyou "github.com/n1neT10ne/aiyou-go-sdk"
+	"github.com/n1neT10ne/aiyou-go-sdk/cassette"
+)
+
+const (
+	testModel = "az-gpt-4o"
+	testToken = "sk-secret-token"
+)
+
+// newServer simule l'API : réponse simple, ou stream en deux fragments espacés
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models":
+			fmt.Fprint(w, `[{"models":[{"name":"az-gpt-4o"}]}]`)
+		case "/chat/completions":
+			if !strings.Contains(readBody(r), `"stream":true`) {
+				fmt.Fprintf(w, `{"choices":[{"message":{"content":"Hi, token %s"}}]}`, testToken)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\ndata: [DONE]\n\n")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readBody lit le corps de la requête
+func readBody(r *http.Request) string {
+	body, _ := io.ReadAll(r.Body)
+	return string(body)
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "cassette.json")
+	server := newServer(t)
+
+	// Enregistrement
+	rec, err := cassette.New(path, cassette.ModeRecord)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts := []aiyou.Option{aiyou.WithBaseURL(server.URL), aiyou.WithTransport(rec)}
+	recorded, err := aiyou.Completion(testModel, testToken, "Hello", opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	streamed, err := aiyou.Completion(testModel, testToken, "Hello", append(opts, aiyou.WithStream(true))...)
+	if err != nil || streamed != "Hello" {
+		t.Fatalf("unexpected stream result %q: %v", streamed, err)
+	}
+	if _, err := aiyou.ListModels(testToken, opts...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), testToken) {
+		t.Errorf("cassette must not contain the token:\n%s", data)
+	}
+	chunks := rec.Interactions()[1].Response.Chunks
+	if len(chunks) < 2 || chunks[len(chunks)-1].Delay < 20*time.Millisecond {
+		t.Errorf("expected chunk timing to be recorded, got %+v", chunks)
+	}
+
+	// Rejeu, serveur arrêté
+	server.Close()
+	play, err := cassette.New(path, cassette.ModeReplay)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	play.Timing = true
+	opts = []aiyou.Option{aiyou.WithBaseURL(server.URL), aiyou.WithTransport(play)}
+
+	got, err := aiyou.Completion(testModel, "another-token", "Hello", opts...)
+	if err != nil || got != strings.ReplaceAll(recorded, testToken, "[SCRUBBED]") {
+		t.Errorf("unexpected replayed result %q: %v", got, err)
+	}
+	start := time.Now()
+	got, err = aiyou.Completion(testModel, testToken, "Hello", append(opts, aiyou.WithStream(true))...)
+	if err != nil || got != "Hello" {
+		t.Errorf("unexpected replayed stream %q: %v", got, err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("expected chunk timing to be replayed")
+	}
+	if _, err := aiyou.ListModels(testToken, opts...); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Chaque échange n'est rejoué qu'une fois, et la correspondance est stricte
+	if _, err := aiyou.Completion(testModel, testToken, "Hello", opts...); !errors.Is(err, cassette.ErrNoInteraction) {
+		t.Errorf("expected ErrNoInteraction for a consumed interaction, got %v", err)
+	}
+}
+
+func TestReplayMatching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	fixture := `{"interactions":[{
+		"request":{"method":"POST","path":"/chat/completions","body":"{\"b\":2,\"a\":1}"},
+		"response":{"status_code":200,"body":"ok"}
+	}]}`
+	if err := os.WriteFile(path, []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   bool
+	}{
+		{name: "different method", method: "PUT", path: "/chat/completions", body: `{"a":1,"b":2}`},
+		{name: "different path", method: "POST", path: "/models", body: `{"a":1,"b":2}`},
+		{name: "different body", method: "POST", path: "/chat/completions", body: `{"a":1,"b":3}`},
+		{name: "normalized body", method: "POST", path: "/chat/completions", body: "{ \"b\": 2,\n \"a\": 1 }", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			play, err := cassette.New(path, cassette.ModeReplay)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			req, _ := http.NewRequest(tt.method, "http://example.com"+tt.path, strings.NewReader(tt.body))
+			resp, err := play.RoundTrip(req)
+			if tt.want {
+				if err != nil || resp.StatusCode != http.StatusOK {
+					t.Errorf("expected match, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, cassette.ErrNoInteraction) {
+				t.Errorf("expected ErrNoInteraction, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	server := newServer(t)
+	path := filepath.Join(t.TempDir(), "unused.json")
+	pass, err := cassette.New(path, cassette.ModePassthrough)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := aiyou.ListModels(testToken, aiyou.WithBaseURL(server.URL), aiyou.WithTransport(pass)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pass.Save(); err != nil || len(pass.Interactions()) != 0 {
+		t.Errorf("passthrough must not record: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("passthrough must not write a cassette")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import "context"
+
+// ChatModel est l'interface d'un modèle conversationnel. Le code applicatif
+// peut en dépendre plutôt que des fonctions du package, afin de substituer
+// une autre implémentation (par exemple aiyoutest.FakeChatModel en test).
+type ChatModel interface {
+	// Chat envoie un message et retourne la réponse complète
+	Chat(ctx context.Context, message string, opts ...Option) (*Result, error)
+
+	// Stream envoie un message en mode streaming ; onChunk est appelé pour
+	// chaque fragment de contenu reçu, puis la réponse complète est retournée
+	Stream(ctx context.Context, message string, onChunk func(content string), opts ...Option) (*Result, error)
+
+	// ListModels retourne les modèles disponibles
+	ListModels(ctx context.Context) ([]Model, error)
+}
+
+// Client est l'implémentation de ChatModel pour l'API AI.You. Il associe un
+// modèle, un token et des options appliqués à chaque appel.
+type Client struct {
+	model string
+	token string
+	opts  []Option
+}
+
+var _ ChatModel = (*Client)(nil)
+
+// NewClient crée un client pour le modèle donné. Le token peut être vide si
+// une source de token est fournie (WithTokenSource).
+func NewClient(model, token string, opts ...Option) *Client {
+	return &Client{
+		model: model,
+		token: token,
+		opts:  append([]Option(nil), opts...),
+	}
+}
+
+// Model retourne le nom du modèle du client
+func (c *Client) Model() string {
+	return c.model
+}
+
+// options retourne les options d'un appel : celles du client, le contexte,
+// puis celles de l'appel
+func (c *Client) options(ctx context.Context, opts []Option) []Option {
+	all := make([]Option, 0, len(c.opts)+len(opts)+1)
+	all = append(all, c.opts...)
+	all = append(all, withContext(ctx))
+	return append(all, opts...)
+}
+
+// Chat implémente ChatModel
+func (c *Client) Chat(ctx context.Context, message string, opts ...Option) (*Result, error) {
+	return CompletionWithResult(c.model, c.token, message, c.options(ctx, opts)...)
+}
+
+// Stream implémente ChatModel ; seuls les fragments du premier choix, suites
+// d'auto-continuation comprises, sont transmis à onChunk
+func (c *Client) Stream(ctx context.Context, message string, onChunk func(content string), opts ...Option) (*Result, error) {
+	stream := []Option{WithStream(true)}
+	if onChunk != nil {
+		stream = append(stream, WithOnChunk(func(choice int, content string) {
+			if choice == 0 {
+				onChunk(content)
+			}
+		}))
+	}
+	return CompletionWithResult(c.model, c.token, message, c.options(ctx, append(stream, opts...))...)
+}
+
+// ListModels implémente ChatModel
+func (c *Client) ListModels(ctx context.Context) ([]Model, error) {
+	return ListModels(c.token, c.options(ctx, nil)...)
+}
+
+// withContext définit le contexte parent de l'appel, qui peut l'annuler
+func withContext(ctx context.Context) Option {
+	return func(o *Options) {
+		if ctx != nil {
+			o.ctx = ctx
+		}
+	}
+}
@@ -7,7 +7,9 @@ package aiyou
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -19,90 +21,121 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-// ListModels récupère la liste des modèles disponibles
-func ListModels(token string, opts ...Option) ([]Model, error) {
-	// Validation du token
-	if token == "" {
-		return nil, ErrEmptyToken
-	}
-
+// ListModels récupère la liste des modèles disponibles. Le token peut être
+// vide si une source de token est fournie (WithTokenSource).
+func ListModels(token string, opts ...Option) (_ []Model, err error) {
 	// Configuration
 	options := defaultOptions()
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	// Création du client HTTP avec timeout
-	client := &http.Client{
-		Timeout: options.Timeout,
+	// Validation du token
+	if err := options.resolveToken(token); err != nil {
+		return nil, err
 	}
+	if err := options.validate(""); err != nil {
+		return nil, err
+	}
+	cancel := withDeadline(options)
+	defer cancel()
 
-	// Création de la requête HTTP
-	httpReq, err := http.NewRequest(
-		"POST",
-		options.BaseURL+"/models",
-		bytes.NewReader([]byte("{}")), // Corps vide requis
+	// Span de l'appel
+	ctx, span := options.startSpan(operationListModels,
+		Attr(AttrOperationName, operationListModels),
+		Attr(AttrSystem, systemName),
 	)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
+	options.ctx = ctx
+	callStart := time.Now()
+	defer func() {
+		options.metrics().ObserveRequest("", time.Since(callStart), callErrorType(err))
+		endSpan(span, err)
+	}()
 
-	// Headers
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+token)
+	// Création du client HTTP avec timeout
+	client := newHTTPClient(options, false)
 
 	// Fonction pour exécuter la requête avec retry
 	var lastErr error
 	maxRetries := getMaxRetries(options.RetryConfig)
-	debugPrint(options, "Starting models request with max retries: %d", maxRetries)
+	options.withLogAttrs("endpoint", "/models")
+	log := options.logger()
+	log.Debug("request start", "max_retries", maxRetries)
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
 			delay := getRetryDelay(attempt, options.RetryConfig)
-			debugPrint(options, "Retry attempt %d/%d, waiting %v", attempt, maxRetries, delay)
-			time.Sleep(delay)
+			log.Info("retry delay", "attempt", attempt, "max_retries", maxRetries, "delay", delay, "error", lastErr)
+			options.metrics().AddRetry("")
+			if err := sleep(options.ctx, delay); err != nil {
+				return nil, fmt.Errorf("max retries exceeded: %w", err)
+			}
 		}
 
+		// Création de la requête HTTP, à chaque tentative car le corps est consommé
+		body := []byte("{}") // Corps vide requis
+		options.RawResponse.captureRequest(body)
+
 		// Exécution de la requête
-		resp, err := client.Do(httpReq)
+		log.Debug("attempt", "attempt", attempt)
+		actx, attemptSpan := options.startSpan(SpanAttempt, Attr(AttrAttempt, attempt))
+		start := time.Now()
+		resp, err := doRequest(client, options, func(token string) (*http.Request, error) {
+			httpReq, err := http.NewRequestWithContext(
+				actx,
+				"POST",
+				options.BaseURL+"/models",
+				bytes.NewReader(body),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("error creating request: %w", err)
+			}
+			setHeaders(httpReq, token, options)
+			return httpReq, nil
+		})
 		if err != nil {
-			lastErr = fmt.Errorf("error executing request: %w", err)
+			lastErr = fmt.Errorf("error executing request: %w", asTimeout(err))
+			log.Warn("request failed", "attempt", attempt, "latency", time.Since(start), "error", lastErr)
+			endSpan(attemptSpan, lastErr)
+			if options.ctx.Err() != nil {
+				return nil, lastErr
+			}
 			continue
 		}
 		defer resp.Body.Close()
+		options.RawResponse.captureResponse(resp)
+		logStatus(log, resp, attempt, start)
+		attemptSpan.SetAttributes(Attr(AttrHTTPStatusCode, resp.StatusCode))
 
 		// Gestion des erreurs HTTP
 		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-			lastErr = handleHTTPError(resp)
-			debugPrint(options, "HTTP error: %v", lastErr)
+			errBody, _ := io.ReadAll(resp.Body)
+			options.RawResponse.captureBody(errBody)
+			lastErr = handleHTTPError(resp, errBody)
+			endSpan(attemptSpan, lastErr)
 			if !shouldRetry(resp.StatusCode) {
 				return nil, lastErr
 			}
 			continue
 		}
 
-		debugPrint(options, "Models request successful: %s", resp.Status)
-
 		// Utilisation de TeeReader pour le debug et le décodage
 		var buf bytes.Buffer
 		teeReader := io.TeeReader(resp.Body, &buf)
 
 		// Lecture de la réponse
 		var modelsResp ModelsResponse
-		if err := json.NewDecoder(teeReader).Decode(&modelsResp); err != nil {
+		err = json.NewDecoder(teeReader).Decode(&modelsResp)
+		io.Copy(io.Discard, teeReader)
+		options.RawResponse.captureBody(buf.Bytes())
+		if err != nil {
 			lastErr = fmt.Errorf("error decoding response: %w", err)
-			if options.Debug {
-				debugPrint(options, "Raw response body: %s", buf.String())
-			}
-			debugPrint(options, "Error decoding response: %v", err)
+			log.Warn("decode error", "attempt", attempt, "error", err, "body", buf.String())
+			endSpan(attemptSpan, lastErr)
 			continue
 		}
-
-		if options.Debug {
-			debugPrint(options, "Raw response body: %s", buf.String())
-		}
-
-		debugJSON(options, "Models Response", modelsResp)
+		log.Debug("response body", "body", buf.String())
+		endSpan(attemptSpan, nil)
 
 		// Extraction des modèles de la structure imbriquée
 		var models []Model
@@ -127,172 +160,381 @@ func Completion(
 	message string,
 	opts ...Option,
 ) (string, error) {
-	// Validation des entrées
-	if token == "" {
-		return "", ErrEmptyToken
-	}
-	if message == "" {
-		return "", ErrEmptyMessage
+	result, err := CompletionWithResult(model, token, message, opts...)
+	if err != nil {
+		// Le contenu partiel d'un stream interrompu est retourné avec l'erreur
+		if result != nil {
+			return result.Content, err
+		}
+		return "", err
 	}
+	return result.Content, nil
+}
 
+// CompletionWithResult envoie une requête à l'API AI.You et retourne la réponse
+// détaillée (contenu, raison d'arrêt, consommation de tokens). Le token peut
+// être vide si une source de token est fournie (WithTokenSource).
+//
+// Si l'auto-continuation est activée (WithAutoContinue) et que la réponse est
+// tronquée (finish_reason "length"), des requêtes de continuation sont envoyées
+// et leurs contenus sont concaténés, la consommation étant cumulée.
+//
+// Si le stream est interrompu (erreur serveur, corruption, coupure réseau),
+// le résultat partiel est retourné avec une *StreamError.
+func CompletionWithResult(
+	model string,
+	token string,
+	message string,
+	opts ...Option,
+) (result *Result, err error) {
 	// Configuration
 	options := defaultOptions()
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	debugJSON(options, "Options", options)
-	debugPrint(options, "Stream mode: %v", options.Stream)
+	// Validation des entrées
+	if err := options.resolveToken(token); err != nil {
+		return nil, err
+	}
+	if message == "" {
+		return nil, ErrEmptyMessage
+	}
+	if err := options.validate(model); err != nil {
+		return nil, err
+	}
+	cancel := withDeadline(options)
+	defer cancel()
+
+	options.withLogAttrs("model", model)
+
+	// Span de l'appel
+	ctx, span := options.startSpan(operationChat+" "+model,
+		Attr(AttrOperationName, operationChat),
+		Attr(AttrSystem, systemName),
+		Attr(AttrRequestModel, model),
+		Attr(AttrRequestTemperature, float64(options.Temperature)),
+		Attr(AttrStream, options.Stream),
+	)
+	if options.N > 1 {
+		span.SetAttributes(Attr(AttrRequestChoiceCount, options.N))
+	}
+	options.ctx = ctx
+	callStart := time.Now()
+
+	// Le délai du premier token est mesuré une fois par appel, depuis son début
+	gotFirstToken := false
+	options.firstToken = func() {
+		if !gotFirstToken {
+			gotFirstToken = true
+			options.metrics().ObserveTimeToFirstToken(model, time.Since(callStart))
+		}
+	}
+	defer func() {
+		metrics := options.metrics()
+		metrics.ObserveRequest(model, time.Since(callStart), callErrorType(err))
+		if result != nil {
+			if !result.UsageEstimated {
+				metrics.AddTokens(model, result.Usage.PromptTokens, result.Usage.CompletionTokens)
+			}
+			span.SetAttributes(resultAttributes(result)...)
+		}
+		endSpan(span, err)
+		if options.AuditLog != nil {
+			record := newAuditRecord(model, message, options, callStart, result, err)
+			if werr := options.AuditLog.Write(record); werr != nil {
+				options.logger().Warn("audit log write failed", "error", werr)
+			}
+		}
+		options.Hooks.response(result, err)
+	}()
+
+	messages := []apiMessage{newTextMessage("user", message)}
+	result, err = complete(model, messages, options)
+	if err != nil {
+		return result, err
+	}
+
+	// Auto-continuation des réponses tronquées, choix par choix
+	single := *options
+	single.N = 0
+	onChunk := options.Hooks.OnChunk
+	for i := range result.Choices {
+		c := &result.Choices[i]
+		if onChunk != nil {
+			// La suite d'un choix est reçue comme choix 0 de la continuation
+			index := c.Index
+			single.Hooks.OnChunk = func(_ int, content string) { onChunk(index, content) }
+		}
+		for n := 0; c.FinishReason == FinishReasonLength && n < options.MaxContinuations; n++ {
+			options.logger().Info("continuing truncated response",
+				"choice", c.Index, "continuation", n+1, "max_continuations", options.MaxContinuations)
+
+			followUp := []apiMessage{
+				messages[0],
+				newTextMessage("assistant", c.Content),
+				newTextMessage("user", options.ContinuePrompt),
+			}
+			next, err := complete(model, followUp, &single)
+			if next != nil {
+				c.Content += next.Content
+				c.FinishReason = next.FinishReason
+				result.Usage.add(next.Usage)
+				result.UsageEstimated = result.UsageEstimated || next.UsageEstimated
+			}
+			if err != nil {
+				result.syncFirstChoice()
+				return result, fmt.Errorf("error continuing truncated response: %w", err)
+			}
+			result.Continuations++
+		}
+	}
+	result.syncFirstChoice()
+
+	return result, nil
+}
 
+// complete envoie une requête de complétion avec les messages fournis, en
+// appliquant la politique de retry
+func complete(model string, messages []apiMessage, options *Options) (*Result, error) {
 	// Préparation de la requête
 	req := apiRequest{
-		Messages: []apiMessage{
-			{
-				Role: "user",
-				Content: []content{
-					{
-						Type: "text",
-						Text: message,
-					},
-				},
-			},
-		},
+		Messages:     messages,
 		Model:        model,
 		Temperature:  options.Temperature,
+		N:            options.N,
 		Stream:       options.Stream,
 		PromptSystem: options.PromptSystem,
 		AssistantID:  options.AssistantID,
 	}
+	if options.Stream && options.StreamUsage {
+		req.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
 
 	// Création du client HTTP avec timeout
-	client := &http.Client{
-		Timeout: options.Timeout,
-	}
+	client := newHTTPClient(options, options.Stream)
 
 	// Encodage de la requête
 	body, err := json.Marshal(req)
 	if err != nil {
-		debugPrint(options, "Error marshaling request: %v", err)
-		return "", fmt.Errorf("error marshaling request: %w", err)
-	}
-	debugJSON(options, "Request", req)
-	debugPrint(options, "Request stream mode: %v", req.Stream)
-
-	// Création de la requête HTTP
-	httpReq, err := http.NewRequest(
-		"POST",
-		options.BaseURL+"/chat/completions",
-		bytes.NewReader(body),
-	)
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	// Headers
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+token)
-
 	// Fonction pour exécuter la requête avec retry
 	var lastErr error
 	maxRetries := getMaxRetries(options.RetryConfig)
-	debugPrint(options, "Starting request with max retries: %d", maxRetries)
+	log := options.logger()
+	log.Debug("request start", "stream", options.Stream, "max_retries", maxRetries,
+		"body", string(body))
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
 			delay := getRetryDelay(attempt, options.RetryConfig)
-			debugPrint(options, "Retry attempt %d/%d, waiting %v", attempt, maxRetries, delay)
-			time.Sleep(delay)
+			log.Info("retry delay", "attempt", attempt, "max_retries", maxRetries, "delay", delay, "error", lastErr)
+			options.metrics().AddRetry(model)
+			options.Hooks.retry(attempt, delay, lastErr)
+			if err := sleep(options.ctx, delay); err != nil {
+				return nil, fmt.Errorf("max retries exceeded: %w", err)
+			}
 		}
 
+		// Création de la requête HTTP, à chaque tentative car le corps est consommé
+		options.RawResponse.captureRequest(body)
+
 		// Exécution de la requête
-		resp, err := client.Do(httpReq)
+		log.Debug("attempt", "attempt", attempt)
+		actx, attemptSpan := options.startSpan(SpanAttempt, Attr(AttrAttempt, attempt))
+		start := time.Now()
+		resp, err := doRequest(client, options, func(token string) (*http.Request, error) {
+			httpReq, err := newCompletionRequest(actx, body, token, options)
+			if err == nil {
+				options.Hooks.request(httpReq, attempt)
+			}
+			return httpReq, err
+		})
 		if err != nil {
-			lastErr = fmt.Errorf("error executing request: %w", err)
+			lastErr = fmt.Errorf("error executing request: %w", asTimeout(err))
+			log.Warn("request failed", "attempt", attempt, "latency", time.Since(start), "error", lastErr)
+			endSpan(attemptSpan, lastErr)
+			if options.ctx.Err() != nil {
+				return nil, lastErr
+			}
 			continue
 		}
 		defer resp.Body.Close()
+		options.RawResponse.captureResponse(resp)
+		logStatus(log, resp, attempt, start)
+		attemptSpan.SetAttributes(Attr(AttrHTTPStatusCode, resp.StatusCode))
 
 		// Gestion des erreurs HTTP
 		if resp.StatusCode != http.StatusOK {
-			var buf bytes.Buffer
-			teeReader := io.TeeReader(resp.Body, &buf)
-			body, _ := io.ReadAll(teeReader)
-			lastErr = handleHTTPError(resp)
-			if options.Debug {
-				debugPrint(options, "Raw error response body: %s", string(body))
-			}
-			debugPrint(options, "HTTP error: %v", lastErr)
+			errBody, _ := io.ReadAll(resp.Body)
+			options.RawResponse.captureBody(errBody)
+			lastErr = handleHTTPError(resp, errBody)
+			log.Debug("error response body", "attempt", attempt, "body", string(errBody))
+			endSpan(attemptSpan, lastErr)
 			if !shouldRetry(resp.StatusCode) {
-				return "", lastErr
+				return nil, lastErr
 			}
 			continue
 		}
 
-		debugPrint(options, "Request successful: %s", resp.Status)
-
-		// Utilisation de TeeReader pour le debug et le décodage
-		var buf bytes.Buffer
-		teeReader := io.TeeReader(resp.Body, &buf)
-
 		// Traitement de la réponse
 		if options.Stream {
-			if options.Debug {
-				// Pour le streaming, on capture le début de la réponse pour le debug
-				body := make([]byte, 1024)
-				n, _ := teeReader.Read(body)
-				if n > 0 {
-					debugPrint(options, "Start of stream response: %s", string(body[:n]))
-				}
-				// Réinitialisation du body pour le streaming
-				resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body[:n]), resp.Body))
+			wd := newWatchdog(options, start)
+			defer wd.stop()
+			result, err := readStream(wd.watch(resp.Body), options, &streamHooks{
+				firstContent: func() {
+					wd.firstToken()
+					attemptSpan.AddEvent(EventFirstToken)
+					if options.firstToken != nil {
+						options.firstToken()
+					}
+				},
+				reconnect: func(lastEventID string) (io.ReadCloser, error) {
+					resumed, err := reconnectStream(actx, client, body, lastEventID, options)
+					if err != nil {
+						return nil, err
+					}
+					return wd.watch(resumed), nil
+				},
+				continueFrom: func(partial string, remaining int) (*Result, error) {
+					followUp := append(messages[:len(messages):len(messages)],
+						newTextMessage("assistant", partial),
+						newTextMessage("user", options.ContinuePrompt),
+					)
+					resumeOptions := *options
+					resumeOptions.MaxResumes = remaining
+					// La suite reprend une partie du contenu déjà transmis :
+					// elle n'est transmise à OnChunk qu'une fois fusionnée
+					resumeOptions.Hooks.OnChunk = nil
+					return complete(model, followUp, &resumeOptions)
+				},
+				restart: func(remaining int) (*Result, error) {
+					resumeOptions := *options
+					resumeOptions.MaxResumes = remaining
+					return complete(model, messages, &resumeOptions)
+				},
+			})
+
+			// Estimation de la consommation si le serveur ne l'a pas envoyée
+			if result != nil && result.Usage == (Usage{}) {
+				result.Usage = estimateUsage(messages, options.PromptSystem, result.Content)
+				result.UsageEstimated = true
+				log.Debug("usage estimated", "prompt_tokens", result.Usage.PromptTokens,
+					"completion_tokens", result.Usage.CompletionTokens)
+			}
+			if result != nil {
+				attemptSpan.AddEvent(EventStreamEnd, resultAttributes(result)...)
 			}
-			return processStream(resp.Body, options)
+			endSpan(attemptSpan, err)
+			return result, err
 		}
 
 		// Lecture de la réponse non-streaming
-		var apiResp apiResponse
-		if err := json.NewDecoder(teeReader).Decode(&apiResp); err != nil {
-			lastErr = fmt.Errorf("error decoding response: %w", err)
-			if options.Debug {
-				debugPrint(options, "Raw response body: %s", buf.String())
-			}
-			debugPrint(options, "Error decoding response: %v", err)
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			lastErr = fmt.Errorf("error reading response: %w", asTimeout(err))
+			log.Warn("request failed", "attempt", attempt, "latency", time.Since(start), "error", lastErr)
+			endSpan(attemptSpan, lastErr)
 			continue
 		}
+		options.RawResponse.captureBody(data)
 
-		if options.Debug {
-			debugPrint(options, "Raw response body: %s", buf.String())
-		}
-		debugJSON(options, "Response", apiResp)
-
-		// Debug détaillé de la structure de la réponse
-		debugPrint(options, "Response choices length: %d", len(apiResp.Response.Choices))
-		if len(apiResp.Response.Choices) > 0 {
-			debugPrint(options, "First choice details: index=%d, finish_reason=%s, role=%s",
-				apiResp.Response.Choices[0].Index,
-				apiResp.Response.Choices[0].FinishReason,
-				apiResp.Response.Choices[0].Message.Role)
+		result, err := decodeResponse(data)
+		if err != nil {
+			lastErr = err
+			log.Warn("decode error", "attempt", attempt, "error", err, "body", string(data))
+			endSpan(attemptSpan, lastErr)
+			// Seul un JSON invalide peut venir d'un incident passager : une
+			// réponse vide ou une erreur du serveur ne changerait pas
+			var apiErr *APIError
+			if errors.As(err, &apiErr) || errors.Is(err, ErrNoContent) {
+				return nil, err
+			}
+			continue
 		}
+		endSpan(attemptSpan, nil)
+		log.Debug("response done", "attempt", attempt, "latency", time.Since(start),
+			"choices", len(result.Choices), "finish_reason", result.FinishReason, "body", string(data))
+
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("max retries exceeded: %w", lastErr)
+}
+
+// newCompletionRequest crée la requête HTTP de complétion
+func newCompletionRequest(ctx context.Context, body []byte, token string, options *Options) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		options.BaseURL+"/chat/completions",
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
 
-		// Extraction du contenu
-		if len(apiResp.Response.Choices) > 0 {
-			return apiResp.Response.Choices[0].Message.Content, nil
+	setHeaders(httpReq, token, options)
+	return httpReq, nil
+}
+
+// setHeaders définit les en-têtes d'une requête : ceux du SDK, puis les
+// en-têtes personnalisés, qui peuvent les remplacer
+func setHeaders(httpReq *http.Request, token string, options *Options) {
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("User-Agent", userAgent(options))
+	for key, values := range options.Headers {
+		httpReq.Header[key] = append([]string(nil), values...)
+	}
+}
+
+// reconnectStream rouvre un stream interrompu en demandant au serveur de
+// reprendre après l'événement lastEventID
+func reconnectStream(ctx context.Context, client *http.Client, body []byte, lastEventID string, options *Options) (io.ReadCloser, error) {
+	resp, err := doRequest(client, options, func(token string) (*http.Request, error) {
+		httpReq, err := newCompletionRequest(ctx, body, token, options)
+		if err != nil {
+			return nil, err
 		}
-		return "", fmt.Errorf("no content in response")
+		httpReq.Header.Set("Last-Event-ID", lastEventID)
+		return httpReq, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error executing request: %w", asTimeout(err))
+	}
+	options.RawResponse.captureResponse(resp)
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		errBody, _ := io.ReadAll(resp.Body)
+		return nil, handleHTTPError(resp, errBody)
 	}
+	return resp.Body, nil
+}
 
-	return "", fmt.Errorf("max retries exceeded: %w", lastErr)
+// newTextMessage crée un message texte pour l'API
+func newTextMessage(role string, text string) apiMessage {
+	return apiMessage{
+		Role: role,
+		Content: []content{
+			{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}
 }
 
 // handleHTTPError convertit les erreurs HTTP en erreurs typées
-func handleHTTPError(resp *http.Response) error {
+func handleHTTPError(resp *http.Response, body []byte) error {
 	switch resp.StatusCode {
 	case http.StatusUnauthorized:
 		return ErrInvalidToken
 	case http.StatusTooManyRequests:
 		return ErrRateLimit
 	case http.StatusBadRequest:
-		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("bad request: %s", string(body))
 	default:
 		return fmt.Errorf("HTTP error %d: %s", resp.StatusCode, resp.Status)
@@ -1,6 +1,8 @@
 package aiyou
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -322,3 +324,437 @@ func TestWithTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestOptionValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   string
+		opts    []Option
+		wantErr error
+	}{
+		{"valid options", modelNonStream, []Option{WithTemperature(0.7), WithTimeout(time.Second)}, nil},
+		{"temperature too high", modelNonStream, []Option{WithTemperature(2.5)}, ErrInvalidTemp},
+		{"temperature too low", modelNonStream, []Option{WithTemperature(-0.1)}, ErrInvalidTemp},
+		{"temperature above model range", "claude-3-5-sonnet", []Option{WithTemperature(1.5)}, ErrInvalidTemp},
+		{"zero timeout", modelNonStream, []Option{WithTimeout(0)}, ErrInvalidOption},
+		{"negative retries", modelNonStream, []Option{WithRetry(-1, time.Millisecond)}, ErrInvalidOption},
+		{"retry without delay", modelNonStream, []Option{WithRetry(3, 0)}, ErrInvalidOption},
+		{"lenient mode", modelNonStream, []Option{WithTemperature(3), WithTimeout(-1), WithLenientOptions(true)}, nil},
+		{"lenient mode with model range", "claude-3-5-sonnet", []Option{WithTemperature(1.5), WithLenientOptions(true)}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.wantErr != nil {
+					t.Error("handler should not be called")
+				}
+				fmt.Fprintln(w, `{"response":{"choices":[{"message":{"content":"Hi"}}]}}`)
+			}))
+			defer server.Close()
+
+			opts := append(tt.opts, WithBaseURL(server.URL))
+			_, err := Completion(tt.model, "test-token", "Hello", opts...)
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLenientTemperature(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		temp  float64
+		want  Temperature
+	}{
+		{"within range", modelNonStream, 1.5, 1.5},
+		{"above global range", modelNonStream, 3, defaultTemp},
+		{"within model range", "claude-3-5-sonnet", 0.5, 0.5},
+		{"above model range", "claude-3-5-sonnet", 1.5, defaultTemp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Temperature
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req apiRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				got = req.Temperature
+				fmt.Fprintln(w, `{"response":{"choices":[{"message":{"content":"Hi"}}]}}`)
+			}))
+			defer server.Close()
+
+			_, err := Completion(tt.model, "test-token", "Hello",
+				WithBaseURL(server.URL), WithTemperature(tt.temp), WithLenientOptions(true))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected temperature %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTemperatureRangeFor(t *testing.T) {
+	tests := []struct {
+		model string
+		want  TemperatureRange
+	}{
+		{modelNonStream, TemperatureRange{Min: 0.0, Max: 2.0}},
+		{modelStream, TemperatureRange{Min: 0.0, Max: 2.0}},
+		{"claude-3-5-sonnet", TemperatureRange{Min: 0.0, Max: 1.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := TemperatureRangeFor(tt.model); got != tt.want {
+				t.Errorf("expected range %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAutoContinue(t *testing.T) {
+	tests := []struct {
+		name     string
+		stream   bool
+		maxCont  int
+		want     string
+		wantCont int
+		wantReq  int
+	}{
+		{"non-streaming", false, 3, "Hello World!", 2, 3},
+		{"streaming", true, 3, "Hello World!", 2, 3},
+		{"limit reached", false, 1, "Hello World", 1, 2},
+		{"disabled", false, 0, "Hello", 0, 1},
+	}
+
+	parts := []struct{ text, reason string }{
+		{"Hello", "length"},
+		{" World", "length"},
+		{"!", "stop"},
+	}
+	previous := []string{"", "Hello", "Hello World"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req apiRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				if requests > 0 {
+					if len(req.Messages) != 3 || req.Messages[1].Role != "assistant" {
+						t.Errorf("unexpected continuation messages: %+v", req.Messages)
+					}
+					if got, want := req.Messages[1].Content[0].Text, previous[requests]; got != want {
+						t.Errorf("expected assistant content %q, got %q", want, got)
+					}
+					if req.Messages[2].Content[0].Text != defaultContinuePrompt {
+						t.Errorf("unexpected continue prompt: %q", req.Messages[2].Content[0].Text)
+					}
+				}
+				part := parts[requests]
+				requests++
+
+				if tt.stream {
+					fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", part.text)
+					fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":%q}],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":5,\"total_tokens\":15}}\n\n", part.reason)
+					fmt.Fprint(w, "data: [DONE]\n\n")
+					return
+				}
+				fmt.Fprintf(w, `{"response":{"choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":%q}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}}`, part.text, part.reason)
+			}))
+			defer server.Close()
+
+			got, err := CompletionWithResult(modelNonStream, "test-token", "Hello",
+				WithBaseURL(server.URL), WithStream(tt.stream), WithAutoContinue(tt.maxCont))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got.Content != tt.want {
+				t.Errorf("expected content %q, got %q", tt.want, got.Content)
+			}
+			if got.Continuations != tt.wantCont {
+				t.Errorf("expected %d continuations, got %d", tt.wantCont, got.Continuations)
+			}
+			if requests != tt.wantReq {
+				t.Errorf("expected %d requests, got %d", tt.wantReq, requests)
+			}
+			if got.Usage.TotalTokens != 15*tt.wantReq {
+				t.Errorf("expected %d total tokens, got %d", 15*tt.wantReq, got.Usage.TotalTokens)
+			}
+		})
+	}
+}
+
+func TestCompletionStreamErrorReturnsPartial(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Once upon\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"error\":{\"message\":\"upstream timeout\"}}\n\n")
+	}))
+	defer server.Close()
+
+	got, err := Completion(modelStream, "test-token", "Tell me a story",
+		WithBaseURL(server.URL), WithStream(true))
+	if !errors.Is(err, ErrStreamAborted) {
+		t.Fatalf("expected ErrStreamAborted, got %v", err)
+	}
+	if got != "Once upon" {
+		t.Errorf("expected partial content %q, got %q", "Once upon", got)
+	}
+}
+
+func TestMultipleChoices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req apiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.N != 3 {
+			t.Errorf("expected n=3, got %d", req.N)
+		}
+		fmt.Fprint(w, `{"response":{"choices":[
+			{"index":0,"message":{"role":"assistant","content":"short"},"finish_reason":"stop"},
+			{"index":1,"message":{"role":"assistant","content":"the longest answer"},"finish_reason":"stop"},
+			{"index":2,"message":{"role":"assistant","content":"medium one"},"finish_reason":"stop"}
+		]}}`)
+	}))
+	defer server.Close()
+
+	got, err := CompletionWithResult(modelNonStream, "test-token", "Hello", WithBaseURL(server.URL), WithN(3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Choices) != 3 {
+		t.Fatalf("expected 3 choices, got %d", len(got.Choices))
+	}
+	if got.Content != "short" {
+		t.Errorf("expected first choice as content, got %q", got.Content)
+	}
+
+	best, ok := got.BestChoice(func(c Choice) float64 { return float64(len(c.Content)) })
+	if !ok || best.Index != 1 {
+		t.Errorf("expected choice 1 as best, got %+v", best)
+	}
+
+	if _, ok := (&Result{}).BestChoice(func(Choice) float64 { return 0 }); ok {
+		t.Error("expected no best choice for empty result")
+	}
+}
+
+func TestRawResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		stream     bool
+		status     int
+		body       string
+		wantStatus int
+		wantBody   string
+		wantEvents int
+	}{
+		{
+			name:       "non-streaming",
+			status:     http.StatusOK,
+			body:       `{"response":{"choices":[{"message":{"content":"Hi"}}],"extra":"field"}}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"response":{"choices":[{"message":{"content":"Hi"}}],"extra":"field"}}`,
+		},
+		{
+			name:       "streaming",
+			stream:     true,
+			status:     http.StatusOK,
+			body:       "id: 1\ndata: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\nevent: ping\ndata: {}\n\ndata: [DONE]\n\n",
+			wantStatus: http.StatusOK,
+			wantEvents: 3,
+		},
+		{
+			name:       "error response",
+			status:     http.StatusBadRequest,
+			body:       `{"error":"invalid model"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"invalid model"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-Id", "req-42")
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			var raw RawResponse
+			_, err := Completion(modelNonStream, "test-token", "Hello",
+				WithBaseURL(server.URL), WithStream(tt.stream), WithRawResponse(&raw))
+			if tt.status == http.StatusOK && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if raw.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, raw.StatusCode)
+			}
+			if raw.Header.Get("X-Request-Id") != "req-42" {
+				t.Errorf("expected response headers, got %v", raw.Header)
+			}
+			if string(raw.Body) != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, string(raw.Body))
+			}
+			if len(raw.Events) != tt.wantEvents {
+				t.Errorf("expected %d events, got %+v", tt.wantEvents, raw.Events)
+			}
+			if tt.wantEvents > 0 && (raw.Events[0].ID != "1" || raw.Events[1].Type != "ping") {
+				t.Errorf("unexpected events: %+v", raw.Events)
+			}
+
+			var req apiRequest
+			if err := json.Unmarshal(raw.RequestBody, &req); err != nil {
+				t.Fatalf("invalid request body %q: %v", raw.RequestBody, err)
+			}
+			if req.Model != modelNonStream || req.Messages[0].Content[0].Text != "Hello" {
+				t.Errorf("unexpected request body: %s", raw.RequestBody)
+			}
+		})
+	}
+}
+
+func TestDecodeErrorRetry(t *testing.T) {
+	isAPIError := func(err error) bool {
+		var apiErr *APIError
+		return errors.As(err, &apiErr)
+	}
+	isMalformed := func(err error) bool {
+		var decodeErr *DecodeError
+		return errors.As(err, &decodeErr) && !errors.Is(err, ErrNoContent)
+	}
+	isNoContent := func(err error) bool { return errors.Is(err, ErrNoContent) }
+
+	tests := []struct {
+		name      string
+		body      string
+		want      func(error) bool
+		wantCalls int
+		retried   bool
+	}{
+		{"malformed json retried", `{"choices":[`, isMalformed, 3, true},
+		{"no choices not retried", `{"choices":[]}`, isNoContent, 1, false},
+		{"error object not retried", `{"error":{"message":"model not found"}}`, isAPIError, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			_, err := Completion(modelNonStream, "test-token", "Hello",
+				WithBaseURL(server.URL), WithRetry(2, time.Millisecond))
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+			if !tt.want(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if retried := err != nil && strings.Contains(err.Error(), "max retries exceeded"); retried != tt.retried {
+				t.Errorf("expected retried=%v, got %v", tt.retried, err)
+			}
+		})
+	}
+}
+
+func TestBadRequestErrorBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "unknown model")
+	}))
+	defer server.Close()
+
+	_, err := Completion(modelNonStream, "test-token", "Hello", WithBaseURL(server.URL))
+	if err == nil || !strings.Contains(err.Error(), "unknown model") {
+		t.Errorf("expected bad request body in error, got %v", err)
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		wantUserAgent string
+		wantHeaders   map[string]string
+	}{
+		{
+			name:          "default user agent",
+			wantUserAgent: "aiyou-go-sdk/" + Version,
+		},
+		{
+			name:          "app name suffix",
+			opts:          []Option{WithAppName("my-app/1.2")},
+			wantUserAgent: "aiyou-go-sdk/" + Version + " my-app/1.2",
+		},
+		{
+			name: "custom headers",
+			opts: []Option{
+				WithHeader("X-Tenant-Id", "acme"),
+				WithHeaders(map[string]string{"traceparent": "00-abc-def-01", "X-Env": "prod"}),
+			},
+			wantUserAgent: "aiyou-go-sdk/" + Version,
+			wantHeaders:   map[string]string{"X-Tenant-Id": "acme", "Traceparent": "00-abc-def-01", "X-Env": "prod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := func(r *http.Request) {
+				if got := r.Header.Get("User-Agent"); got != tt.wantUserAgent {
+					t.Errorf("%s: expected User-Agent %q, got %q", r.URL.Path, tt.wantUserAgent, got)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+					t.Errorf("%s: unexpected Authorization %q", r.URL.Path, got)
+				}
+				for key, want := range tt.wantHeaders {
+					if got := r.Header.Get(key); got != want {
+						t.Errorf("%s: expected header %s=%q, got %q", r.URL.Path, key, want, got)
+					}
+				}
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				check(r)
+				if r.URL.Path == "/models" {
+					fmt.Fprint(w, `[{"models":[{"name":"az-gpt-4o"}]}]`)
+					return
+				}
+				fmt.Fprint(w, `{"response":{"choices":[{"message":{"content":"Hi"}}]}}`)
+			}))
+			defer server.Close()
+
+			opts := append(tt.opts, WithBaseURL(server.URL))
+			if _, err := Completion(modelNonStream, "test-token", "Hello", opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := ListModels("test-token", opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -5,7 +5,11 @@
 
 package aiyou
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
 
 // Erreurs spécifiques du package
 var (
@@ -24,12 +28,102 @@ var (
 	// ErrStreamCorrupted est retourné quand le stream de réponse est corrompu
 	ErrStreamCorrupted = errors.New("stream corrupted")
 
-	// ErrInvalidTemp est retourné quand la température est hors limites (0.0-1.0)
-	ErrInvalidTemp = errors.New("temperature must be between 0.0 and 1.0")
+	// ErrStreamAborted est retourné quand le serveur envoie une erreur au milieu du stream
+	ErrStreamAborted = errors.New("stream aborted by server")
+
+	// ErrInvalidTemp est retourné quand la température est hors de la plage
+	// autorisée (0.0-2.0, ou plage propre au modèle, voir TemperatureRangeFor)
+	ErrInvalidTemp = errors.New("temperature out of range")
+
+	// ErrInvalidOption est retourné quand une option reçoit une valeur invalide
+	ErrInvalidOption = errors.New("invalid option")
 
 	// ErrEmptyMessage est retourné quand le message est vide
 	ErrEmptyMessage = errors.New("message cannot be empty")
 
+	// ErrNoContent est retourné quand la réponse ne contient aucun choix
+	ErrNoContent = errors.New("no content in response")
+
+	// ErrNoVotes est retourné par Vote quand aucun échantillon n'a produit de réponse
+	ErrNoVotes = errors.New("no valid vote")
+
 	// ErrEmptyToken est retourné quand le token est vide
 	ErrEmptyToken = errors.New("token cannot be empty")
 )
+
+// APIError représente une erreur renvoyée par le serveur
+type APIError struct {
+	// Message est le message d'erreur du serveur
+	Message string
+
+	// Type est le type d'erreur, s'il est fourni
+	Type string
+
+	// Code est le code d'erreur, s'il est fourni
+	Code string
+
+	// Raw contient le payload brut reçu
+	Raw json.RawMessage
+}
+
+func (e *APIError) Error() string {
+	msg := "api error"
+	if e.Type != "" {
+		msg += " (" + e.Type + ")"
+	}
+	if e.Code != "" {
+		msg += " [" + e.Code + "]"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// DecodeError est retourné quand le corps d'une réponse ne correspond à aucun
+// des formats connus
+type DecodeError struct {
+	// Snippet contient le début du corps reçu
+	Snippet string
+
+	// Err est la cause de l'échec (erreur JSON ou ErrNoContent)
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("error decoding response: %v (body: %s)", e.Err, e.Snippet)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// StreamError est retourné quand un stream est interrompu avant sa fin. Le
+// contenu et la consommation reçus avant l'interruption sont conservés dans
+// Partial, ce qui permet de les afficher ou de reprendre à partir de là.
+type StreamError struct {
+	// Err est la cause de l'interruption (ErrStreamCorrupted, ErrStreamAborted
+	// ou erreur de transport)
+	Err error
+
+	// APIError contient l'erreur envoyée par le serveur, le cas échéant
+	APIError *APIError
+
+	// Partial contient le résultat reçu avant l'interruption
+	Partial *Result
+}
+
+func (e *StreamError) Error() string {
+	if e.APIError != nil {
+		return fmt.Sprintf("%v: %v", e.Err, e.APIError)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap permet d'utiliser errors.Is et errors.As sur la cause et sur l'erreur serveur
+func (e *StreamError) Unwrap() []error {
+	if e.APIError != nil {
+		return []error{e.Err, e.APIError}
+	}
+	return []error{e.Err}
+}
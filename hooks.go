@@ -0,0 +1,116 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"net/http"
+	"time"
+)
+
+// Hooks sont des fonctions appelées aux étapes clés d'une complétion, plus
+// légères qu'un middleware. Elles sont appelées de manière synchrone et ne
+// doivent donc pas bloquer.
+type Hooks struct {
+	// OnRequest est appelé avant chaque tentative, avec la requête HTTP
+	OnRequest func(req *http.Request, attempt int)
+
+	// OnRetry est appelé à chaque décision de retry, avec le délai d'attente
+	// et l'erreur de la tentative précédente
+	OnRetry func(attempt int, delay time.Duration, reason error)
+
+	// OnChunk est appelé pour chaque fragment de contenu reçu en streaming ;
+	// le contenu renvoyé lors d'une reprise du stream n'est pas retransmis
+	OnChunk func(choice int, content string)
+
+	// OnResponse est appelé à la fin de l'appel, avec le résultat (éventuellement
+	// partiel) et l'erreur
+	OnResponse func(result *Result, err error)
+}
+
+// request appelle OnRequest s'il est défini
+func (h Hooks) request(req *http.Request, attempt int) {
+	if h.OnRequest != nil {
+		h.OnRequest(req, attempt)
+	}
+}
+
+// retry appelle OnRetry s'il est défini
+func (h Hooks) retry(attempt int, delay time.Duration, reason error) {
+	if h.OnRetry != nil {
+		h.OnRetry(attempt, delay, reason)
+	}
+}
+
+// chunk appelle OnChunk s'il est défini
+func (h Hooks) chunk(choice int, content string) {
+	if h.OnChunk != nil {
+		h.OnChunk(choice, content)
+	}
+}
+
+// response appelle OnResponse s'il est défini
+func (h Hooks) response(result *Result, err error) {
+	if h.OnResponse != nil {
+		h.OnResponse(result, err)
+	}
+}
+
+// WithOnRequest enregistre une fonction appelée avant chaque tentative ; les
+// fonctions enregistrées plusieurs fois sont appelées dans l'ordre
+func WithOnRequest(fn func(req *http.Request, attempt int)) Option {
+	return func(o *Options) {
+		if prev := o.Hooks.OnRequest; prev != nil {
+			o.Hooks.OnRequest = func(req *http.Request, attempt int) {
+				prev(req, attempt)
+				fn(req, attempt)
+			}
+			return
+		}
+		o.Hooks.OnRequest = fn
+	}
+}
+
+// WithOnRetry enregistre une fonction appelée à chaque décision de retry
+func WithOnRetry(fn func(attempt int, delay time.Duration, reason error)) Option {
+	return func(o *Options) {
+		if prev := o.Hooks.OnRetry; prev != nil {
+			o.Hooks.OnRetry = func(attempt int, delay time.Duration, reason error) {
+				prev(attempt, delay, reason)
+				fn(attempt, delay, reason)
+			}
+			return
+		}
+		o.Hooks.OnRetry = fn
+	}
+}
+
+// WithOnChunk enregistre une fonction appelée pour chaque fragment reçu en streaming
+func WithOnChunk(fn func(choice int, content string)) Option {
+	return func(o *Options) {
+		if prev := o.Hooks.OnChunk; prev != nil {
+			o.Hooks.OnChunk = func(choice int, content string) {
+				prev(choice, content)
+				fn(choice, content)
+			}
+			return
+		}
+		o.Hooks.OnChunk = fn
+	}
+}
+
+// WithOnResponse enregistre une fonction appelée à la fin de chaque appel
+func WithOnResponse(fn func(result *Result, err error)) Option {
+	return func(o *Options) {
+		if prev := o.Hooks.OnResponse; prev != nil {
+			o.Hooks.OnResponse = func(result *Result, err error) {
+				prev(result, err)
+				fn(result, err)
+			}
+			return
+		}
+		o.Hooks.OnResponse = fn
+	}
+}
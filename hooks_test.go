@@ -0,0 +1,185 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.Header.Get("X-Audit") != "1" {
+			t.Errorf("expected header set by OnRequest")
+		}
+		fmt.Fprint(w, streamChunk("Hel")+streamChunk("lo")+"data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	var events []string
+	_, err := Completion(modelStream, "test-token", "Hello",
+		WithBaseURL(server.URL),
+		WithStream(true),
+		WithRetry(1, time.Millisecond),
+		WithOnRequest(func(req *http.Request, attempt int) {
+			req.Header.Set("X-Audit", "1")
+			events = append(events, fmt.Sprintf("request %d", attempt))
+		}),
+		WithOnRetry(func(attempt int, delay time.Duration, reason error) {
+			events = append(events, fmt.Sprintf("retry %d %v", attempt, strings.Contains(reason.Error(), "502")))
+		}),
+		WithOnChunk(func(choice int, content string) {
+			events = append(events, fmt.Sprintf("chunk %d %s", choice, content))
+		}),
+		WithOnResponse(func(result *Result, err error) {
+			events = append(events, fmt.Sprintf("response %s %v", result.Content, err))
+		}),
+		WithOnResponse(func(result *Result, err error) {
+			events = append(events, "second response hook")
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"request 0",
+		"retry 1 true",
+		"request 1",
+		"chunk 0 Hel",
+		"chunk 0 lo",
+		"response Hello <nil>",
+		"second response hook",
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected hook sequence:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestOnResponseError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	var got error
+	Completion(modelNonStream, "test-token", "Hello",
+		WithBaseURL(server.URL),
+		WithOnResponse(func(result *Result, err error) { got = err }),
+	)
+	if !errors.Is(got, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken in OnResponse, got %v", got)
+	}
+}
+
+func TestOnChunkStreamResume(t *testing.T) {
+	chunk := func(id, content string) string {
+		event := ""
+		if id != "" {
+			event = "id: " + id + "\n"
+		}
+		return event + fmt.Sprintf("data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", content)
+	}
+
+	tests := []struct {
+		name      string
+		responses []string
+	}{
+		{
+			name:      "events after last id are resent",
+			responses: []string{chunk("1", "Hello") + chunk("", " wor"), chunk("2", " wor") + chunk("3", "ld")},
+		},
+		{
+			name:      "server replaying from start",
+			responses: []string{chunk("1", "Hello") + chunk("", " wor"), chunk("1", "Hello") + chunk("", " wor") + chunk("2", "ld")},
+		},
+		{
+			name:      "continuation with overlap",
+			responses: []string{chunk("", "Hello world, this"), chunk("", "world, this is it")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, tt.responses[requests])
+				requests++
+				if requests < len(tt.responses) {
+					dropConnection(t, w)
+					return
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+
+			var delivered strings.Builder
+			result, err := CompletionWithResult(modelStream, "test-token", "Hello",
+				WithBaseURL(server.URL),
+				WithStream(true),
+				WithStreamResume(2),
+				WithOnChunk(func(choice int, content string) {
+					delivered.WriteString(content)
+				}),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if delivered.String() != result.Content {
+				t.Errorf("expected chunks to add up to %q, got %q", result.Content, delivered.String())
+			}
+		})
+	}
+}
+
+func TestOnChunkAutoContinueChoices(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Red\"},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":1,\"delta\":{\"content\":\"Blue\"},\"finish_reason\":\"length\"}]}\n\n")
+		} else {
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" sky\"},\"finish_reason\":\"stop\"}]}\n\n")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	delivered := map[int]string{}
+	result, err := CompletionWithResult(modelStream, "test-token", "Hello",
+		WithBaseURL(server.URL),
+		WithStream(true),
+		WithN(2),
+		WithAutoContinue(1),
+		WithOnChunk(func(choice int, content string) {
+			delivered[choice] += content
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+	for _, c := range result.Choices {
+		if delivered[c.Index] != c.Content {
+			t.Errorf("choice %d: expected chunks to add up to %q, got %q", c.Index, c.Content, delivered[c.Index])
+		}
+	}
+}
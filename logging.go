@@ -0,0 +1,69 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// logger retourne le logger de l'appel : celui de WithLogger, sinon un
+// logger texte sur la sortie d'erreur au niveau debug si WithDebug est
+// activé, sinon un logger silencieux. Les événements sont masqués par le
+// redactor de l'appel avant d'être transmis.
+func (o *Options) logger() *slog.Logger {
+	if o.log == nil {
+		var handler slog.Handler
+		switch {
+		case o.Logger != nil:
+			handler = o.Logger.Handler()
+		case o.Debug:
+			handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+		default:
+			o.log = slog.New(discardHandler{})
+			return o.log
+		}
+		o.redactor = newRedactor(o)
+		o.log = slog.New(&redactHandler{next: handler, redactor: o.redactor})
+	}
+	return o.log
+}
+
+// withLogAttrs ajoute des attributs à tous les événements suivants de l'appel
+func (o *Options) withLogAttrs(args ...any) {
+	o.log = o.logger().With(args...)
+}
+
+// requestID retourne l'identifiant de requête renvoyé par le serveur
+func requestID(resp *http.Response) string {
+	return resp.Header.Get("X-Request-Id")
+}
+
+// discardHandler est un slog.Handler qui ignore tous les événements
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
+
+// logStatus journalise le statut d'une réponse HTTP, au niveau warn s'il
+// s'agit d'une erreur
+func logStatus(log *slog.Logger, resp *http.Response, attempt int, start time.Time) {
+	level := slog.LevelDebug
+	if resp.StatusCode >= 400 {
+		level = slog.LevelWarn
+	}
+	log.Log(context.Background(), level, "response status",
+		"attempt", attempt,
+		"status", resp.StatusCode,
+		"latency", time.Since(start),
+		"request_id", requestID(resp),
+	)
+}
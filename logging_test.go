@@ -0,0 +1,132 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// logRecords décode les événements écrits par un slog.JSONHandler
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			t.Fatalf("invalid log record: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// findRecord retourne le premier événement portant le message donné
+func findRecord(records []map[string]any, msg string) map[string]any {
+	for _, r := range records {
+		if r["msg"] == msg {
+			return r
+		}
+	}
+	return nil
+}
+
+func TestWithLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  bool
+		handler http.HandlerFunc
+		want    map[string]map[string]any
+	}{
+		{
+			name: "retry and status",
+			handler: func() http.HandlerFunc {
+				calls := 0
+				return func(w http.ResponseWriter, r *http.Request) {
+					calls++
+					w.Header().Set("X-Request-Id", fmt.Sprintf("req-%d", calls))
+					if calls == 1 {
+						w.WriteHeader(http.StatusServiceUnavailable)
+						return
+					}
+					fmt.Fprint(w, `{"choices":[{"message":{"content":"Hi"},"finish_reason":"stop"}]}`)
+				}
+			}(),
+			want: map[string]map[string]any{
+				"request start":   {"model": modelNonStream, "level": "DEBUG"},
+				"retry delay":     {"attempt": 1.0, "level": "INFO"},
+				"response status": {"status": 503.0, "request_id": "req-1", "attempt": 0.0, "level": "WARN"},
+				"response done":   {"finish_reason": "stop", "attempt": 1.0},
+			},
+		},
+		{
+			name:   "stream chunks",
+			stream: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, streamChunk("Hel")+streamChunk("lo")+"data: [DONE]\n\n")
+			},
+			want: map[string]map[string]any{
+				"chunk received": {"model": modelStream, "choice": 0.0, "content": "Hel"},
+				"stream done":    {"content_length": 5.0},
+			},
+		},
+		{
+			name: "decode error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `not json`)
+			},
+			want: map[string]map[string]any{
+				"decode error": {"body": "not json", "level": "WARN"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			model := modelNonStream
+			if tt.stream {
+				model = modelStream
+			}
+			Completion(model, "test-token", "Hello",
+				WithBaseURL(server.URL),
+				WithStream(tt.stream),
+				WithRetry(1, time.Millisecond),
+				WithLogger(logger),
+			)
+
+			records := logRecords(t, &buf)
+			for msg, attrs := range tt.want {
+				record := findRecord(records, msg)
+				if record == nil {
+					t.Errorf("missing %q event in %v", msg, records)
+					continue
+				}
+				for key, want := range attrs {
+					if record[key] != want {
+						t.Errorf("%q: expected %s=%v, got %v", msg, key, want, record[key])
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := Completion(modelNonStream, "test-token", "Hello", WithLogger(nil)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption for nil logger, got %v", err)
+	}
+}
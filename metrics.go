@@ -0,0 +1,253 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsRecorder reçoit les métriques des appels, par modèle (vide pour
+// ListModels). Les implémentations doivent supporter les appels concurrents.
+type MetricsRecorder interface {
+	// ObserveRequest est appelé à la fin de chaque appel, avec sa durée
+	// totale et le type d'erreur (vide en cas de succès, sinon la valeur de
+	// l'attribut de trace error.type)
+	ObserveRequest(model string, latency time.Duration, errorType string)
+
+	// ObserveTimeToFirstToken est appelé une fois par appel en streaming, à la
+	// réception du premier token, avec le délai depuis le début de l'appel
+	ObserveTimeToFirstToken(model string, ttft time.Duration)
+
+	// AddTokens est appelé avec la consommation de tokens d'un appel, si elle
+	// a été envoyée par le serveur (une consommation estimée n'est pas comptée)
+	AddTokens(model string, input, output int)
+
+	// AddRetry est appelé à chaque nouvelle tentative
+	AddRetry(model string)
+}
+
+// DefaultLatencyBuckets sont les bornes (en secondes) des histogrammes de MemoryMetrics
+var DefaultLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Histogram est un histogramme cumulatif de durées, en secondes
+type Histogram struct {
+	// Buckets sont les bornes supérieures des intervalles
+	Buckets []float64
+
+	// Counts[i] est le nombre d'observations inférieures ou égales à Buckets[i]
+	Counts []uint64
+
+	// Count est le nombre total d'observations
+	Count uint64
+
+	// Sum est la somme des observations
+	Sum float64
+}
+
+// observe ajoute une observation à l'histogramme
+func (h *Histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Buckets = DefaultLatencyBuckets
+		h.Counts = make([]uint64, len(h.Buckets))
+	}
+	seconds := d.Seconds()
+	for i, bound := range h.Buckets {
+		if seconds <= bound {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += seconds
+}
+
+// ModelMetrics sont les métriques cumulées d'un modèle
+type ModelMetrics struct {
+	Requests         uint64
+	Errors           map[string]uint64
+	Latency          Histogram
+	TimeToFirstToken Histogram
+	InputTokens      uint64
+	OutputTokens     uint64
+	Retries          uint64
+}
+
+// MemoryMetrics est un MetricsRecorder qui cumule les métriques en mémoire
+type MemoryMetrics struct {
+	mu     sync.Mutex
+	models map[string]*ModelMetrics
+}
+
+// NewMemoryMetrics crée un MetricsRecorder en mémoire
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{models: make(map[string]*ModelMetrics)}
+}
+
+// model retourne les métriques d'un modèle ; doit être appelé verrouillé
+func (m *MemoryMetrics) model(name string) *ModelMetrics {
+	mm, ok := m.models[name]
+	if !ok {
+		mm = &ModelMetrics{Errors: make(map[string]uint64)}
+		m.models[name] = mm
+	}
+	return mm
+}
+
+// ObserveRequest implémente MetricsRecorder
+func (m *MemoryMetrics) ObserveRequest(model string, latency time.Duration, errorType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.model(model)
+	mm.Requests++
+	mm.Latency.observe(latency)
+	if errorType != "" {
+		mm.Errors[errorType]++
+	}
+}
+
+// ObserveTimeToFirstToken implémente MetricsRecorder
+func (m *MemoryMetrics) ObserveTimeToFirstToken(model string, ttft time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.model(model).TimeToFirstToken.observe(ttft)
+}
+
+// AddTokens implémente MetricsRecorder
+func (m *MemoryMetrics) AddTokens(model string, input, output int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.model(model)
+	mm.InputTokens += uint64(input)
+	mm.OutputTokens += uint64(output)
+}
+
+// AddRetry implémente MetricsRecorder
+func (m *MemoryMetrics) AddRetry(model string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.model(model).Retries++
+}
+
+// Snapshot retourne une copie des métriques, par modèle
+func (m *MemoryMetrics) Snapshot() map[string]ModelMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]ModelMetrics, len(m.models))
+	for name, mm := range m.models {
+		c := *mm
+		c.Errors = make(map[string]uint64, len(mm.Errors))
+		for k, v := range mm.Errors {
+			c.Errors[k] = v
+		}
+		c.Latency.Counts = append([]uint64(nil), mm.Latency.Counts...)
+		c.TimeToFirstToken.Counts = append([]uint64(nil), mm.TimeToFirstToken.Counts...)
+		snapshot[name] = c
+	}
+	return snapshot
+}
+
+// PrometheusHandler expose les métriques au format texte de Prometheus
+func PrometheusHandler(metrics *MemoryMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheus(w, metrics.Snapshot())
+	})
+}
+
+// writePrometheus écrit les métriques au format texte de Prometheus
+func writePrometheus(w io.Writer, snapshot map[string]ModelMetrics) {
+	models := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		models = append(models, name)
+	}
+	sort.Strings(models)
+
+	counter := func(name, help string, value func(ModelMetrics) uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, model := range models {
+			fmt.Fprintf(w, "%s{model=%s} %d\n", name, quoteLabel(model), value(snapshot[model]))
+		}
+	}
+	histogram := func(name, help string, value func(ModelMetrics) Histogram) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+		for _, model := range models {
+			h := value(snapshot[model])
+			label := quoteLabel(model)
+			for i, bound := range h.Buckets {
+				fmt.Fprintf(w, "%s_bucket{model=%s,le=\"%s\"} %d\n",
+					name, label, strconv.FormatFloat(bound, 'g', -1, 64), h.Counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{model=%s,le=\"+Inf\"} %d\n", name, label, h.Count)
+			fmt.Fprintf(w, "%s_sum{model=%s} %s\n", name, label, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+			fmt.Fprintf(w, "%s_count{model=%s} %d\n", name, label, h.Count)
+		}
+	}
+
+	counter("aiyou_requests_total", "Number of calls.",
+		func(m ModelMetrics) uint64 { return m.Requests })
+	counter("aiyou_retries_total", "Number of retried attempts.",
+		func(m ModelMetrics) uint64 { return m.Retries })
+
+	fmt.Fprint(w, "# HELP aiyou_errors_total Number of failed calls, by error type.\n# TYPE aiyou_errors_total counter\n")
+	for _, model := range models {
+		errorTypes := make([]string, 0, len(snapshot[model].Errors))
+		for t := range snapshot[model].Errors {
+			errorTypes = append(errorTypes, t)
+		}
+		sort.Strings(errorTypes)
+		for _, t := range errorTypes {
+			fmt.Fprintf(w, "aiyou_errors_total{model=%s,type=%s} %d\n",
+				quoteLabel(model), quoteLabel(t), snapshot[model].Errors[t])
+		}
+	}
+
+	fmt.Fprint(w, "# HELP aiyou_tokens_total Number of tokens, by direction.\n# TYPE aiyou_tokens_total counter\n")
+	for _, model := range models {
+		fmt.Fprintf(w, "aiyou_tokens_total{model=%s,direction=\"input\"} %d\n", quoteLabel(model), snapshot[model].InputTokens)
+		fmt.Fprintf(w, "aiyou_tokens_total{model=%s,direction=\"output\"} %d\n", quoteLabel(model), snapshot[model].OutputTokens)
+	}
+
+	histogram("aiyou_request_duration_seconds", "Call latency.",
+		func(m ModelMetrics) Histogram { return m.Latency })
+	histogram("aiyou_time_to_first_token_seconds", "Time to first token in streaming mode.",
+		func(m ModelMetrics) Histogram { return m.TimeToFirstToken })
+}
+
+// quoteLabel échappe une valeur de label Prometheus
+func quoteLabel(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// callErrorType retourne le type d'erreur d'un appel, vide en cas de succès
+func callErrorType(err error) string {
+	if err == nil {
+		return ""
+	}
+	return errorType(err)
+}
+
+// metrics retourne le MetricsRecorder de l'appel, ou un recorder inactif
+func (o *Options) metrics() MetricsRecorder {
+	if o.Metrics == nil {
+		return noopMetrics{}
+	}
+	return o.Metrics
+}
+
+// noopMetrics est le MetricsRecorder utilisé quand aucun n'est configuré
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(string, time.Duration, string)  {}
+func (noopMetrics) ObserveTimeToFirstToken(string, time.Duration) {}
+func (noopMetrics) AddTokens(string, int, int)                    {}
+func (noopMetrics) AddRetry(string)                               {}
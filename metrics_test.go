@@ -0,0 +1,152 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryMetrics(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			fmt.Fprint(w, `{"choices":[{"message":{"content":"Hi"}}],"usage":{"prompt_tokens":7,"completion_tokens":3}}`)
+		case 3:
+			fmt.Fprint(w, streamChunk("Hello")+`data: {"choices":[],"usage":{"prompt_tokens":4,"completion_tokens":1}}`+"\n\n")
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	metrics := NewMemoryMetrics()
+	opts := []Option{WithBaseURL(server.URL), WithMetrics(metrics)}
+	if _, err := Completion(modelNonStream, "test-token", "Hello", append(opts, WithRetry(1, time.Millisecond))...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Completion(modelStream, "test-token", "Hello", append(opts, WithStream(true))...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Completion(modelNonStream, "test-token", "Hello", opts...); err == nil {
+		t.Fatal("expected rate limit error")
+	}
+
+	snapshot := metrics.Snapshot()
+	nonStream, stream := snapshot[modelNonStream], snapshot[modelStream]
+	if nonStream.Requests != 2 || nonStream.Retries != 1 || nonStream.Latency.Count != 2 {
+		t.Errorf("unexpected non-stream metrics: %+v", nonStream)
+	}
+	if nonStream.InputTokens != 7 || nonStream.OutputTokens != 3 {
+		t.Errorf("unexpected tokens: in=%d out=%d", nonStream.InputTokens, nonStream.OutputTokens)
+	}
+	if nonStream.Errors["rate_limit"] != 1 || len(nonStream.Errors) != 1 {
+		t.Errorf("unexpected errors: %v", nonStream.Errors)
+	}
+	if stream.Requests != 1 || stream.TimeToFirstToken.Count != 1 || stream.OutputTokens != 1 {
+		t.Errorf("unexpected stream metrics: %+v", stream)
+	}
+}
+
+func TestMetricsAutoContinue(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		reason := "length"
+		if calls == 3 {
+			reason = "stop"
+		}
+		fmt.Fprint(w, streamChunk("part"))
+		fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":%q}],\"usage\":{\"prompt_tokens\":2,\"completion_tokens\":1}}\n\n", reason)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	metrics := NewMemoryMetrics()
+	result, err := CompletionWithResult(modelStream, "test-token", "Hello",
+		WithBaseURL(server.URL), WithStream(true), WithAutoContinue(2), WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Continuations != 2 {
+		t.Fatalf("expected 2 continuations, got %d", result.Continuations)
+	}
+
+	stream := metrics.Snapshot()[modelStream]
+	if stream.Requests != 1 || stream.TimeToFirstToken.Count != 1 {
+		t.Errorf("expected one call and one time to first token, got %+v", stream)
+	}
+	if stream.InputTokens != 6 || stream.OutputTokens != 3 {
+		t.Errorf("unexpected tokens: in=%d out=%d", stream.InputTokens, stream.OutputTokens)
+	}
+}
+
+func TestMetricsSkipEstimatedUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, streamChunk("Hello world")+"data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	metrics := NewMemoryMetrics()
+	result, err := CompletionWithResult(modelStream, "test-token", "Hello",
+		WithBaseURL(server.URL), WithStream(true), WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.UsageEstimated {
+		t.Fatal("expected estimated usage")
+	}
+
+	stream := metrics.Snapshot()[modelStream]
+	if stream.Requests != 1 || stream.InputTokens != 0 || stream.OutputTokens != 0 {
+		t.Errorf("expected estimated usage not to be counted: %+v", stream)
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	metrics.ObserveRequest("gpt", 300*time.Millisecond, "")
+	metrics.ObserveRequest("gpt", 2*time.Second, "timeout")
+	metrics.AddTokens("gpt", 10, 5)
+	metrics.AddRetry("gpt")
+
+	server := httptest.NewServer(PrometheusHandler(metrics))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{
+		"# TYPE aiyou_requests_total counter",
+		`aiyou_requests_total{model="gpt"} 2`,
+		`aiyou_retries_total{model="gpt"} 1`,
+		`aiyou_errors_total{model="gpt",type="timeout"} 1`,
+		`aiyou_tokens_total{model="gpt",direction="input"} 10`,
+		`aiyou_tokens_total{model="gpt",direction="output"} 5`,
+		"# TYPE aiyou_request_duration_seconds histogram",
+		`aiyou_request_duration_seconds_bucket{model="gpt",le="0.5"} 1`,
+		`aiyou_request_duration_seconds_bucket{model="gpt",le="2.5"} 2`,
+		`aiyou_request_duration_seconds_bucket{model="gpt",le="+Inf"} 2`,
+		`aiyou_request_duration_seconds_sum{model="gpt"} 2.3`,
+		`aiyou_time_to_first_token_seconds_count{model="gpt"} 0`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import "net/http"
+
+// Handler envoie une requête HTTP et retourne la réponse
+type Handler func(req *http.Request) (*http.Response, error)
+
+// Middleware enveloppe un Handler pour observer ou modifier les requêtes et
+// les réponses (signature, métriques, cache, injection de fautes...). La
+// chaîne est appliquée à chaque tentative, à l'intérieur de la boucle de
+// retry : une erreur retournée par un middleware est donc retentée comme une
+// erreur réseau.
+type Middleware func(next Handler) Handler
+
+// chain applique les middlewares autour du handler final ; le premier
+// middleware est le plus externe
+func chain(final Handler, middlewares []Middleware) Handler {
+	h := final
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc adapte une fonction en http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// jsonResponse construit une réponse HTTP 200 avec le corps donné
+func jsonResponse(req *http.Request, body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+">")
+				req.Header.Set("X-"+name, "1")
+				resp, err := next(req)
+				order = append(order, "<"+name)
+				return resp, err
+			}
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Outer") == "" || r.Header.Get("X-Inner") == "" {
+			t.Errorf("middleware headers missing: %v", r.Header)
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"Hi"}}]}`)
+	}))
+	defer server.Close()
+
+	_, err := Completion(modelNonStream, "test-token", "Hello",
+		WithBaseURL(server.URL),
+		WithMiddleware(trace("Outer"), trace("Inner")),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(order, " "); got != "Outer> Inner> <Inner <Outer" {
+		t.Errorf("unexpected middleware order: %s", got)
+	}
+}
+
+func TestMiddlewareRetried(t *testing.T) {
+	errInjected := errors.New("injected fault")
+	var attempts int
+	faulty := func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, errInjected
+			}
+			return next(req)
+		}
+	}
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return jsonResponse(req, `{"choices":[{"message":{"content":"Hi"}}]}`), nil
+	})
+
+	got, err := Completion(modelNonStream, "test-token", "Hello",
+		WithTransport(transport),
+		WithMiddleware(faulty),
+		WithRetry(1, time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "Hi" || attempts != 2 {
+		t.Errorf("expected Hi after 2 attempts, got %q after %d", got, attempts)
+	}
+}
+
+func TestCustomHTTPClient(t *testing.T) {
+	var viaClient, viaTransport int
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		viaClient++
+		return jsonResponse(req, `[{"models":[{"name":"az-gpt-4o"}]}]`), nil
+	})}
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		viaTransport++
+		return jsonResponse(req, `[{"models":[{"name":"az-gpt-4o"}]}]`), nil
+	})
+
+	if _, err := ListModels("test-token", WithHTTPClient(client)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ListModels("test-token", WithHTTPClient(client), WithTransport(transport)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if viaClient != 1 || viaTransport != 1 {
+		t.Errorf("expected 1 request per transport, got client=%d transport=%d", viaClient, viaTransport)
+	}
+
+	for _, opt := range []Option{WithHTTPClient(nil), WithTransport(nil), WithMiddleware(nil)} {
+		if _, err := ListModels("test-token", opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected ErrInvalidOption, got %v", err)
+		}
+	}
+}
@@ -6,9 +6,15 @@
 package aiyou
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // apiMessage représente le format du message envoyé à l'API
@@ -53,41 +59,271 @@ func (c ContextWindow) MarshalJSON() ([]byte, error) {
 	return json.Marshal(int(c))
 }
 
+// Float est un float64 toujours encodé comme un littéral flottant dans le JSON.
+// L'API exige un point décimal (1.0 et non 1) ; la représentation la plus
+// courte est utilisée pour ne perdre aucune précision (0.75 reste 0.75).
+// Tous les paramètres d'échantillonnage flottants doivent utiliser ce type.
+type Float float64
+
+func (f Float) MarshalJSON() ([]byte, error) {
+	return marshalFloat(float64(f))
+}
+
+// marshalFloat encode un float64 sans perte de précision, avec au moins une décimale
+func marshalFloat(f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("unsupported float value: %v", f)
+	}
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		// Force le format float avec .0 pour les nombres entiers
+		s += ".0"
+	}
+	return []byte(s), nil
+}
+
 // Temperature est un type personnalisé pour s'assurer que la température est toujours
 // formatée comme un float dans le JSON
-type Temperature float64
+type Temperature Float
 
 func (t Temperature) MarshalJSON() ([]byte, error) {
-	// Force le format float avec .0 pour les nombres entiers
-	return []byte(fmt.Sprintf("%.1f", float64(t))), nil
+	return marshalFloat(float64(t))
+}
+
+// Choice représente un choix de la réponse
+type Choice struct {
+	// Index est la position du choix dans la réponse
+	Index int
+
+	// Role est le rôle de l'auteur du choix
+	Role string
+
+	// Content est le texte généré pour ce choix
+	Content string
+
+	// FinishReason indique pourquoi la génération de ce choix s'est arrêtée
+	FinishReason string
+}
+
+// syncFirstChoice reporte le premier choix dans les champs Content,
+// FinishReason et Role
+func (r *Result) syncFirstChoice() {
+	if len(r.Choices) == 0 {
+		return
+	}
+	r.Role = r.Choices[0].Role
+	r.Content = r.Choices[0].Content
+	r.FinishReason = r.Choices[0].FinishReason
+}
+
+// BestChoice retourne le choix ayant le meilleur score selon la fonction
+// fournie (le premier en cas d'égalité), ou false si la réponse n'a aucun choix
+func (r *Result) BestChoice(score func(Choice) float64) (Choice, bool) {
+	if len(r.Choices) == 0 {
+		return Choice{}, false
+	}
+	best, bestScore := r.Choices[0], score(r.Choices[0])
+	for _, c := range r.Choices[1:] {
+		if s := score(c); s > bestScore {
+			best, bestScore = c, s
+		}
+	}
+	return best, true
+}
+
+// estimateTokens estime le nombre de tokens d'un texte (environ 4 caractères par token)
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// estimateUsage estime la consommation d'une requête à partir des messages
+// envoyés, du prompt système et du contenu généré
+func estimateUsage(messages []apiMessage, promptSystem string, completion string) Usage {
+	prompt := estimateTokens(promptSystem)
+	for _, m := range messages {
+		for _, c := range m.Content {
+			prompt += estimateTokens(c.Text)
+		}
+	}
+	generated := estimateTokens(completion)
+	return Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: generated,
+		TotalTokens:      prompt + generated,
+	}
+}
+
+// streamOptions configure les informations renvoyées en mode streaming
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// RawResponse capture l'échange HTTP brut d'un appel, pour accéder aux
+// informations absentes des types du SDK. Avec plusieurs requêtes (retries,
+// continuations, reprises), seule la dernière est conservée. Une même
+// RawResponse ne doit pas être partagée entre des appels concurrents.
+type RawResponse struct {
+	// RequestBody est le corps JSON exact de la requête envoyée
+	RequestBody []byte
+
+	// StatusCode est le code HTTP de la réponse
+	StatusCode int
+
+	// Header contient les en-têtes de la réponse
+	Header http.Header
+
+	// Body contient le corps brut de la réponse (vide en mode streaming)
+	Body []byte
+
+	// Events contient les événements SSE reçus en mode streaming
+	Events []RawEvent
+}
+
+// RawEvent représente un événement SSE brut
+type RawEvent struct {
+	// Type est le type de l'événement ("message" par défaut)
+	Type string
+
+	// ID est l'identifiant de l'événement
+	ID string
+
+	// Data contient les données de l'événement
+	Data string
+}
+
+// captureRequest enregistre le corps d'une nouvelle requête et réinitialise la réponse
+func (r *RawResponse) captureRequest(body []byte) {
+	if r == nil {
+		return
+	}
+	*r = RawResponse{RequestBody: bytes.Clone(body)}
+}
+
+// captureResponse enregistre le statut et les en-têtes d'une réponse
+func (r *RawResponse) captureResponse(resp *http.Response) {
+	if r == nil {
+		return
+	}
+	r.StatusCode = resp.StatusCode
+	r.Header = resp.Header.Clone()
+}
+
+// captureBody enregistre le corps d'une réponse
+func (r *RawResponse) captureBody(body []byte) {
+	if r == nil {
+		return
+	}
+	r.Body = bytes.Clone(body)
+}
+
+// captureEvent enregistre un événement SSE reçu
+func (r *RawResponse) captureEvent(event *sseEvent) {
+	if r == nil {
+		return
+	}
+	r.Events = append(r.Events, RawEvent{Type: event.Type, ID: event.ID, Data: string(event.Data)})
 }
 
 // apiRequest représente la requête complète envoyée à l'API
 type apiRequest struct {
-	Messages     []apiMessage `json:"messages"`
-	Model        string       `json:"model,omitempty"`
-	AssistantID  string       `json:"assistantId,omitempty"`
-	Temperature  Temperature  `json:"temperature"`
-	Stream       bool         `json:"stream"`
-	PromptSystem string       `json:"promptSystem,omitempty"`
+	Messages      []apiMessage   `json:"messages"`
+	Model         string         `json:"model,omitempty"`
+	AssistantID   string         `json:"assistantId,omitempty"`
+	Temperature   Temperature    `json:"temperature"`
+	N             int            `json:"n,omitempty"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+	PromptSystem  string         `json:"promptSystem,omitempty"`
 }
 
-// apiResponse représente la réponse de l'API en mode non-streaming
+// apiResponse représente la réponse de l'API en mode non-streaming. L'API
+// AI.You encapsule la réponse dans un objet "response", les API compatibles
+// OpenAI la renvoient directement : les deux formes sont acceptées.
 type apiResponse struct {
-	Response struct {
-		Model   string   `json:"model"`
-		ID      string   `json:"id"`
-		Created int64    `json:"created"`
-		Choices []choice `json:"choices"`
-		Usage   usage    `json:"usage"`
-	} `json:"response"`
+	Response *responseBody `json:"response"`
+	responseBody
+}
+
+// responseBody représente le contenu d'une réponse non-streaming
+type responseBody struct {
+	Model   string   `json:"model"`
+	ID      string   `json:"id"`
+	Created int64    `json:"created"`
+	Choices []choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
 }
 
-// choice représente un choix dans la réponse
+// choice représente un choix dans la réponse. Certains serveurs renvoient
+// un chunk de stream (delta) au lieu d'un message complet.
 type choice struct {
-	Index        int     `json:"index"`
-	Message      message `json:"message"`
-	FinishReason string  `json:"finish_reason"`
+	Index        int      `json:"index"`
+	Message      *message `json:"message"`
+	Delta        *delta   `json:"delta"`
+	FinishReason string   `json:"finish_reason"`
+}
+
+// decodeSnippetLength est la longueur maximale de l'extrait de corps inclus
+// dans une DecodeError
+const decodeSnippetLength = 200
+
+// decodeResponse décode le corps d'une réponse non-streaming. Trois formes
+// sont acceptées : l'enveloppe AI.You ({"response": {"choices": ...}}),
+// l'enveloppe compatible OpenAI ({"choices": [{"message": ...}]}) et un
+// chunk de stream ({"choices": [{"delta": ...}]}).
+func decodeResponse(data []byte) (*Result, error) {
+	if apiErr := extractAPIError(data); apiErr != nil {
+		return nil, apiErr
+	}
+
+	var resp apiResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, newDecodeError(data, err)
+	}
+	body := &resp.responseBody
+	if resp.Response != nil {
+		body = resp.Response
+	}
+
+	result := &Result{
+		ID:    body.ID,
+		Model: body.Model,
+		Usage: body.Usage,
+	}
+	for _, c := range body.Choices {
+		var m message
+		switch {
+		case c.Message != nil:
+			m = *c.Message
+		case c.Delta != nil:
+			m = message{Role: c.Delta.Role, Content: c.Delta.Content}
+		default:
+			continue
+		}
+		result.Choices = append(result.Choices, Choice{
+			Index:        c.Index,
+			Role:         m.Role,
+			Content:      m.Content,
+			FinishReason: c.FinishReason,
+		})
+	}
+	if len(result.Choices) == 0 {
+		return nil, newDecodeError(data, ErrNoContent)
+	}
+
+	sort.SliceStable(result.Choices, func(i, j int) bool {
+		return result.Choices[i].Index < result.Choices[j].Index
+	})
+	result.syncFirstChoice()
+	return result, nil
+}
+
+// newDecodeError crée une DecodeError avec un extrait du corps reçu
+func newDecodeError(data []byte, err error) *DecodeError {
+	snippet := string(data)
+	if len(snippet) > decodeSnippetLength {
+		snippet = strings.ToValidUTF8(snippet[:decodeSnippetLength], "") + "..."
+	}
+	return &DecodeError{Snippet: snippet, Err: err}
 }
 
 // message représente le message dans la réponse
@@ -109,26 +345,74 @@ type Model struct {
 	Name string
 }
 
-// usage représente les statistiques d'utilisation des tokens
-type usage struct {
+// Usage représente les statistiques d'utilisation des tokens
+type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// add cumule les statistiques d'une autre réponse
+func (u *Usage) add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// Raisons d'arrêt de la génération renvoyées par l'API
+const (
+	// FinishReasonStop indique que le modèle a terminé naturellement sa réponse
+	FinishReasonStop = "stop"
+
+	// FinishReasonLength indique que la réponse a été tronquée par la limite de tokens
+	FinishReasonLength = "length"
+)
+
+// Result représente le résultat détaillé d'une complétion
+type Result struct {
+	// ID est l'identifiant de la réponse
+	ID string
+
+	// Model est le modèle ayant généré la réponse
+	Model string
+
+	// Role est le rôle de l'auteur de la réponse (assistant)
+	Role string
+
+	// Content est le texte généré (celui du premier choix)
+	Content string
+
+	// FinishReason indique pourquoi la génération s'est arrêtée (stop, length...)
+	FinishReason string
+
+	// Choices contient tous les choix renvoyés par l'API (plusieurs avec WithN)
+	Choices []Choice
+
+	// Usage contient la consommation de tokens, cumulée sur les continuations
+	Usage Usage
+
+	// UsageEstimated indique que Usage a été estimé localement, le serveur
+	// ne l'ayant pas fourni (cas fréquent en mode streaming)
+	UsageEstimated bool
+
+	// Continuations est le nombre de requêtes de continuation envoyées
+	Continuations int
+}
+
 // streamResponse représente un chunk de réponse en mode streaming
 type streamResponse struct {
 	Model   string         `json:"model"`
 	ID      string         `json:"id"`
 	Created int64          `json:"created"`
 	Choices []streamChoice `json:"choices"`
-	Usage   *usage         `json:"usage,omitempty"`
+	Usage   *Usage         `json:"usage,omitempty"`
 }
 
 // streamChoice représente un choix dans la réponse streaming
 type streamChoice struct {
-	Index int   `json:"index"`
-	Delta delta `json:"delta"`
+	Index        int    `json:"index"`
+	Delta        delta  `json:"delta"`
+	FinishReason string `json:"finish_reason"`
 }
 
 // delta représente le contenu incrémental dans la réponse streaming
@@ -0,0 +1,160 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFloatMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		want  string
+	}{
+		{"integer", 1, "1.0"},
+		{"zero", 0, "0.0"},
+		{"one decimal", 0.8, "0.8"},
+		{"two decimals", 0.75, "0.75"},
+		{"many decimals", 0.123456789, "0.123456789"},
+		{"small value", 1e-7, "0.0000001"},
+		{"negative", -0.5, "-0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, v := range []interface{}{Float(tt.value), Temperature(tt.value)} {
+				data, err := json.Marshal(v)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if string(data) != tt.want {
+					t.Errorf("%T: expected %s, got %s", v, tt.want, string(data))
+				}
+			}
+		})
+	}
+}
+
+func TestFloatRoundTrip(t *testing.T) {
+	values := []float64{0, 0.1, 0.7, 0.75, 1, 1.05, 1.999999, 2, 0.30000000000000004}
+
+	for _, v := range values {
+		data, err := json.Marshal(apiRequest{Temperature: Temperature(v)})
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %v", v, err)
+		}
+
+		var decoded struct {
+			Temperature float64 `json:"temperature"`
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", data, err)
+		}
+		if decoded.Temperature != v {
+			t.Errorf("round trip of %v returned %v (%s)", v, decoded.Temperature, data)
+		}
+	}
+}
+
+func TestFloatMarshalJSONInvalid(t *testing.T) {
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := json.Marshal(Float(v)); err == nil {
+			t.Errorf("expected error for %v", v)
+		}
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       string
+		wantReason string
+		wantTokens int
+	}{
+		{
+			name:       "wrapped envelope",
+			body:       `{"response":{"id":"r1","model":"az-gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],"usage":{"total_tokens":7}}}`,
+			want:       "Hello",
+			wantReason: "stop",
+			wantTokens: 7,
+		},
+		{
+			name:       "plain envelope",
+			body:       `{"id":"r1","model":"az-gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],"usage":{"total_tokens":7}}`,
+			want:       "Hello",
+			wantReason: "stop",
+			wantTokens: 7,
+		},
+		{
+			name: "stream-shaped body",
+			body: `{"model":"az-gpt-4o","id":"r1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+			want: "Hello",
+		},
+		{
+			name: "choices out of order",
+			body: `{"choices":[{"index":1,"message":{"content":"second"}},{"index":0,"message":{"content":"first"}}]}`,
+			want: "first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeResponse([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Content != tt.want || got.FinishReason != tt.wantReason || got.Usage.TotalTokens != tt.wantTokens {
+				t.Errorf("expected %q (%q, %d tokens), got %+v", tt.want, tt.wantReason, tt.wantTokens, got)
+			}
+		})
+	}
+}
+
+func TestDecodeResponseErrors(t *testing.T) {
+	long := `{"unexpected":"` + strings.Repeat("x", 500) + `"}`
+
+	tests := []struct {
+		name        string
+		body        string
+		wantErr     error
+		wantSnippet string
+	}{
+		{"no choices", `{"result":"Hello"}`, ErrNoContent, `{"result":"Hello"}`},
+		{"empty choices", `{"response":{"choices":[]}}`, ErrNoContent, `{"response":{"choices":[]}}`},
+		{"invalid json", `<html>Bad gateway</html>`, nil, `<html>Bad gateway</html>`},
+		{"long body truncated", long, ErrNoContent, long[:decodeSnippetLength] + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeResponse([]byte(tt.body))
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("expected *DecodeError, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if decodeErr.Snippet != tt.wantSnippet {
+				t.Errorf("expected snippet %q, got %q", tt.wantSnippet, decodeErr.Snippet)
+			}
+		})
+	}
+}
+
+func TestDecodeResponseAPIError(t *testing.T) {
+	_, err := decodeResponse([]byte(`{"error":{"message":"model not found","type":"invalid_request_error"}}`))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "model not found" {
+		t.Errorf("expected API error, got %v", err)
+	}
+}
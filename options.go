@@ -5,33 +5,141 @@
 
 package aiyou
 
-import "time"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
 
 // Options contient les options configurables du client
 type Options struct {
 	// BaseURL définit l'URL de base de l'API
 	BaseURL string
 
-	// Temperature contrôle la créativité des réponses (0.0-1.0)
+	// Temperature contrôle la créativité des réponses (0.0-2.0, voir TemperatureRangeFor)
 	Temperature Temperature
 
-	// Timeout définit le délai maximum pour une requête
+	// Timeout définit le délai maximum pour une requête. En mode streaming, il
+	// ne limite que l'attente des en-têtes de la réponse.
 	Timeout time.Duration
 
+	// ConnectTimeout définit le délai maximum d'établissement de la connexion
+	// (0 utilise la valeur par défaut du transport HTTP)
+	ConnectTimeout time.Duration
+
+	// FirstTokenTimeout définit le délai maximum entre l'envoi de la requête et
+	// la réception du premier token en mode streaming (0 désactive le contrôle)
+	FirstTokenTimeout time.Duration
+
+	// IdleTimeout définit le délai maximum sans données reçues pendant un
+	// stream (0 désactive le contrôle)
+	IdleTimeout time.Duration
+
+	// Deadline définit la durée maximum d'un appel complet, retries,
+	// continuations et reprises comprises (0 désactive le contrôle)
+	Deadline time.Duration
+
 	// RetryConfig configure la politique de retry
 	RetryConfig *RetryConfig
 
 	// PromptSystem définit le prompt système à utiliser
 	PromptSystem string
 
+	// N est le nombre de choix à générer (0 utilise la valeur par défaut de l'API)
+	N int
+
 	// Stream indique si le modèle utilise le streaming
 	Stream bool
 
-	// Debug active l'affichage des messages de debug
+	// StreamUsage demande au serveur d'envoyer la consommation de tokens dans
+	// le dernier chunk du stream (stream_options.include_usage)
+	StreamUsage bool
+
+	// Debug active l'affichage des événements de debug sur la sortie
+	// d'erreur, si aucun Logger n'est défini
 	Debug bool
 
+	// Logger reçoit les événements structurés des appels
+	Logger *slog.Logger
+
+	// AuditLog, si défini, reçoit un enregistrement par complétion
+	AuditLog *AuditLog
+
+	// Hooks sont appelés aux étapes clés des complétions
+	Hooks Hooks
+
+	// Metrics, si défini, reçoit les métriques des appels
+	Metrics MetricsRecorder
+
+	// Tracer, si défini, trace les appels et leurs tentatives
+	Tracer Tracer
+
+	// RedactPatterns sont masqués dans les logs, en plus des tokens
+	RedactPatterns []*regexp.Regexp
+
+	// LogBody détermine ce qui est journalisé des corps de requête et de réponse
+	LogBody LogBodyMode
+
 	// AssistantID spécifie l'ID de l'assistant à utiliser
 	AssistantID string
+
+	// MaxContinuations est le nombre maximum de requêtes de continuation
+	// envoyées quand une réponse est tronquée (0 désactive l'auto-continuation)
+	MaxContinuations int
+
+	// ContinuePrompt est le message envoyé pour demander la suite d'une réponse tronquée
+	ContinuePrompt string
+
+	// MaxResumes est le nombre maximum de reprises d'un stream interrompu par
+	// une erreur de transport (0 désactive la reprise)
+	MaxResumes int
+
+	// TokenSource fournit le token d'authentification, consulté à chaque
+	// tentative ; s'il est défini, il remplace le token passé en paramètre
+	TokenSource TokenSource
+
+	// Headers contient les en-têtes ajoutés à chaque requête
+	Headers http.Header
+
+	// AppName est ajouté à l'en-tête User-Agent (aiyou-go-sdk/<version> <AppName>)
+	AppName string
+
+	// HTTPClient, si défini, remplace le client HTTP construit par le SDK
+	HTTPClient *http.Client
+
+	// Transport, si défini, remplace le transport HTTP du client
+	Transport http.RoundTripper
+
+	// Middlewares enveloppent chaque tentative de requête HTTP
+	Middlewares []Middleware
+
+	// RawResponse, si défini, reçoit l'échange HTTP brut de l'appel
+	RawResponse *RawResponse
+
+	// Lenient désactive la validation stricte : les valeurs invalides sont
+	// ignorées silencieusement au lieu de provoquer une erreur
+	Lenient bool
+
+	// errs contient les erreurs de validation relevées par les options
+	errs []error
+
+	// log est le logger résolu de l'appel, enrichi de ses attributs
+	log *slog.Logger
+
+	// redactor masque les secrets dans les événements de log
+	redactor *redactor
+
+	// ctx porte la Deadline de l'appel en cours
+	ctx context.Context
+
+	// firstToken est appelé à la réception de chaque premier token d'une
+	// requête de l'appel (continuations et reprises comprises)
+	firstToken func()
 }
 
 // RetryConfig configure le comportement des retries
@@ -50,19 +158,79 @@ type RetryConfig struct {
 const (
 	defaultTimeout = 30 * time.Second
 	minTemperature = 0.0
-	maxTemperature = 1.0
+	maxTemperature = 2.0
 	defaultTemp    = 1.0
+
+	defaultContinuePrompt = "Continue exactly where you stopped. Do not repeat anything you already wrote."
 )
 
 // Option est une fonction qui configure les Options
 type Option func(*Options)
 
+// TemperatureRange définit la plage de température acceptée par un modèle
+type TemperatureRange struct {
+	Min float64
+	Max float64
+}
+
+// modelTemperatureRanges associe un fragment de nom de modèle à sa plage de
+// température autorisée. Les modèles absents de la table acceptent la plage
+// par défaut 0.0-2.0 (convention des API compatibles OpenAI).
+//
+//	Fragment   Plage      Origine
+//	claude     0.0-1.0    API Anthropic
+var modelTemperatureRanges = []struct {
+	fragment string
+	rng      TemperatureRange
+}{
+	{"claude", TemperatureRange{Min: 0.0, Max: 1.0}},
+}
+
+// TemperatureRangeFor retourne la plage de température autorisée pour un modèle
+func TemperatureRangeFor(model string) TemperatureRange {
+	name := strings.ToLower(model)
+	for _, m := range modelTemperatureRanges {
+		if strings.Contains(name, m.fragment) {
+			return m.rng
+		}
+	}
+	return TemperatureRange{Min: minTemperature, Max: maxTemperature}
+}
+
+// addError enregistre une erreur de validation
+func (o *Options) addError(err error) {
+	o.errs = append(o.errs, err)
+}
+
+// validate retourne les erreurs relevées par les options, complétées par les
+// vérifications dépendant du modèle. En mode lenient, aucune erreur n'est
+// retournée et les valeurs invalides gardent leur valeur par défaut ; une
+// température hors de la plage du modèle revient à la valeur par défaut.
+func (o *Options) validate(model string) error {
+	errs := o.errs
+	if model != "" {
+		rng := TemperatureRangeFor(model)
+		if temp := float64(o.Temperature); temp < rng.Min || temp > rng.Max {
+			if o.Lenient {
+				o.Temperature = Temperature(defaultTemp)
+			}
+			errs = append(errs, fmt.Errorf("%w: %v not in [%v, %v] for model %q",
+				ErrInvalidTemp, temp, rng.Min, rng.Max, model))
+		}
+	}
+	if o.Lenient {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
 // WithTemperature définit la température pour les réponses
 func WithTemperature(temp float64) Option {
 	return func(o *Options) {
-		// Always set the temperature if it's within bounds
-		if temp < float64(minTemperature) || temp > float64(maxTemperature) {
-			// If out of bounds, keep default value
+		if temp < minTemperature || temp > maxTemperature {
+			// Hors limites : on garde la valeur par défaut
+			o.addError(fmt.Errorf("%w: %v not in [%v, %v]",
+				ErrInvalidTemp, temp, minTemperature, maxTemperature))
 			return
 		}
 		o.Temperature = Temperature(temp)
@@ -72,8 +240,55 @@ func WithTemperature(temp float64) Option {
 // WithTimeout définit le timeout des requêtes
 func WithTimeout(timeout time.Duration) Option {
 	return func(o *Options) {
-		if timeout > 0 {
-			o.Timeout = timeout
+		if timeout <= 0 {
+			o.addError(fmt.Errorf("%w: timeout must be positive, got %v", ErrInvalidOption, timeout))
+			return
+		}
+		o.Timeout = timeout
+	}
+}
+
+// positiveDuration vérifie qu'une durée d'option est strictement positive
+func positiveDuration(o *Options, name string, d time.Duration) bool {
+	if d <= 0 {
+		o.addError(fmt.Errorf("%w: %s must be positive, got %v", ErrInvalidOption, name, d))
+		return false
+	}
+	return true
+}
+
+// WithConnectTimeout définit le délai maximum d'établissement de la connexion
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		if positiveDuration(o, "connect timeout", timeout) {
+			o.ConnectTimeout = timeout
+		}
+	}
+}
+
+// WithFirstTokenTimeout définit le délai maximum avant le premier token d'un stream
+func WithFirstTokenTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		if positiveDuration(o, "first token timeout", timeout) {
+			o.FirstTokenTimeout = timeout
+		}
+	}
+}
+
+// WithIdleTimeout définit le délai maximum sans données reçues pendant un stream
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		if positiveDuration(o, "idle timeout", timeout) {
+			o.IdleTimeout = timeout
+		}
+	}
+}
+
+// WithDeadline définit la durée maximum d'un appel complet
+func WithDeadline(deadline time.Duration) Option {
+	return func(o *Options) {
+		if positiveDuration(o, "deadline", deadline) {
+			o.Deadline = deadline
 		}
 	}
 }
@@ -81,13 +296,28 @@ func WithTimeout(timeout time.Duration) Option {
 // WithRetry configure la politique de retry
 func WithRetry(maxRetries int, retryDelay time.Duration) Option {
 	return func(o *Options) {
-		if maxRetries > 0 && retryDelay > 0 {
-			o.RetryConfig = &RetryConfig{
-				MaxRetries: maxRetries,
-				RetryDelay: retryDelay,
-				MaxDelay:   retryDelay * 4, // Exponential backoff max
-			}
+		if maxRetries < 0 || retryDelay < 0 || (maxRetries > 0 && retryDelay == 0) {
+			o.addError(fmt.Errorf("%w: invalid retry policy (maxRetries=%d, retryDelay=%v)",
+				ErrInvalidOption, maxRetries, retryDelay))
+			return
 		}
+		if maxRetries == 0 {
+			o.RetryConfig = nil
+			return
+		}
+		o.RetryConfig = &RetryConfig{
+			MaxRetries: maxRetries,
+			RetryDelay: retryDelay,
+			MaxDelay:   retryDelay * 4, // Exponential backoff max
+		}
+	}
+}
+
+// WithLenientOptions active le mode lenient : les options invalides sont
+// ignorées silencieusement, comme dans les versions précédentes du SDK
+func WithLenientOptions(lenient bool) Option {
+	return func(o *Options) {
+		o.Lenient = lenient
 	}
 }
 
@@ -98,6 +328,18 @@ func WithSystemPrompt(prompt string) Option {
 	}
 }
 
+// WithN demande la génération de n choix pour le même message. Tous les choix
+// sont disponibles dans Result.Choices ; Completion retourne le premier.
+func WithN(n int) Option {
+	return func(o *Options) {
+		if n < 1 {
+			o.addError(fmt.Errorf("%w: n must be at least 1, got %d", ErrInvalidOption, n))
+			return
+		}
+		o.N = n
+	}
+}
+
 // WithStream active ou désactive le mode streaming
 func WithStream(stream bool) Option {
 	return func(o *Options) {
@@ -105,7 +347,18 @@ func WithStream(stream bool) Option {
 	}
 }
 
-// WithDebug active ou désactive les messages de debug
+// WithStreamUsage demande l'envoi de la consommation de tokens en mode
+// streaming. Sans cette option, la consommation est estimée si le serveur
+// ne l'envoie pas.
+func WithStreamUsage(include bool) Option {
+	return func(o *Options) {
+		o.StreamUsage = include
+	}
+}
+
+// WithDebug active ou désactive les événements de debug sur la sortie
+// d'erreur ; raccourci pour un logger texte au niveau debug, ignoré si
+// WithLogger est utilisé
 func WithDebug(debug bool) Option {
 	return func(o *Options) {
 		o.Debug = debug
@@ -125,6 +378,92 @@ func defaultOptions() *Options {
 		Stream:       false,
 		Debug:        false,
 		AssistantID:  "",
+
+		MaxContinuations: 0,
+		ContinuePrompt:   defaultContinuePrompt,
+		MaxResumes:       0,
+		Lenient:          false,
+
+		ctx: context.Background(),
+	}
+}
+
+// WithLogger envoie les événements structurés des appels (début de requête,
+// tentatives, retries, statut, chunks reçus, fin de stream, erreurs de
+// décodage) au logger fourni, avec les attributs model, attempt, latency et
+// request_id
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		if logger == nil {
+			o.addError(fmt.Errorf("%w: logger cannot be nil", ErrInvalidOption))
+			return
+		}
+		o.Logger = logger
+	}
+}
+
+// WithAuditLog ajoute au journal fourni un enregistrement JSON par complétion
+// (horodatage, modèle, options, messages, réponse, consommation, latence,
+// erreur). Les échecs d'écriture sont journalisés sans faire échouer l'appel.
+func WithAuditLog(log *AuditLog) Option {
+	return func(o *Options) {
+		if log == nil {
+			o.addError(fmt.Errorf("%w: audit log cannot be nil", ErrInvalidOption))
+			return
+		}
+		o.AuditLog = log
+	}
+}
+
+// WithMetrics envoie les métriques des appels (nombre, latence, temps
+// jusqu'au premier token, tokens consommés, retries, erreurs par type) au
+// recorder fourni, par exemple NewMemoryMetrics
+func WithMetrics(recorder MetricsRecorder) Option {
+	return func(o *Options) {
+		if recorder == nil {
+			o.addError(fmt.Errorf("%w: metrics recorder cannot be nil", ErrInvalidOption))
+			return
+		}
+		o.Metrics = recorder
+	}
+}
+
+// WithTracer trace les appels (un span par appel, un span enfant par
+// tentative) avec les attributs des conventions sémantiques GenAI
+func WithTracer(tracer Tracer) Option {
+	return func(o *Options) {
+		if tracer == nil {
+			o.addError(fmt.Errorf("%w: tracer cannot be nil", ErrInvalidOption))
+			return
+		}
+		o.Tracer = tracer
+	}
+}
+
+// WithRedact masque les motifs fournis dans tous les événements de log (par
+// exemple RedactEmails, RedactPhoneNumbers ou une expression personnalisée).
+// Les tokens d'authentification sont toujours masqués.
+func WithRedact(patterns ...*regexp.Regexp) Option {
+	return func(o *Options) {
+		for _, p := range patterns {
+			if p == nil {
+				o.addError(fmt.Errorf("%w: redact pattern cannot be nil", ErrInvalidOption))
+				continue
+			}
+			o.RedactPatterns = append(o.RedactPatterns, p)
+		}
+	}
+}
+
+// WithLogBody détermine ce qui est journalisé des corps de requête et de
+// réponse : taille seulement, corps tronqués (par défaut) ou complets
+func WithLogBody(mode LogBodyMode) Option {
+	return func(o *Options) {
+		if mode < LogBodyTruncated || mode > LogBodyFull {
+			o.addError(fmt.Errorf("%w: unknown log body mode %d", ErrInvalidOption, mode))
+			return
+		}
+		o.LogBody = mode
 	}
 }
 
@@ -135,6 +474,153 @@ func WithAssistantID(assistantID string) Option {
 	}
 }
 
+// WithAutoContinue active l'auto-continuation : quand une réponse est tronquée
+// (finish_reason "length"), jusqu'à maxContinuations requêtes sont envoyées pour
+// obtenir la suite, et les réponses sont concaténées
+func WithAutoContinue(maxContinuations int) Option {
+	return func(o *Options) {
+		if maxContinuations < 0 {
+			o.addError(fmt.Errorf("%w: maxContinuations must not be negative, got %d",
+				ErrInvalidOption, maxContinuations))
+			return
+		}
+		o.MaxContinuations = maxContinuations
+	}
+}
+
+// WithContinuePrompt définit le message utilisé pour demander la suite d'une réponse tronquée
+func WithContinuePrompt(prompt string) Option {
+	return func(o *Options) {
+		if prompt == "" {
+			o.addError(fmt.Errorf("%w: continue prompt cannot be empty", ErrInvalidOption))
+			return
+		}
+		o.ContinuePrompt = prompt
+	}
+}
+
+// WithStreamResume active la reprise des streams interrompus par une erreur de
+// transport, au plus maxResumes fois. Le stream est rouvert avec l'en-tête
+// Last-Event-ID si le serveur numérote ses événements, sinon une requête de
+// continuation est envoyée et le contenu redondant est supprimé.
+func WithStreamResume(maxResumes int) Option {
+	return func(o *Options) {
+		if maxResumes < 0 {
+			o.addError(fmt.Errorf("%w: maxResumes must not be negative, got %d",
+				ErrInvalidOption, maxResumes))
+			return
+		}
+		o.MaxResumes = maxResumes
+	}
+}
+
+// WithTokenSource définit la source du token d'authentification, consultée à
+// chaque tentative. Sur un refus du serveur (401), le token est renouvelé une
+// fois avant de retourner ErrInvalidToken.
+func WithTokenSource(source TokenSource) Option {
+	return func(o *Options) {
+		if source == nil {
+			o.addError(fmt.Errorf("%w: token source cannot be nil", ErrInvalidOption))
+			return
+		}
+		o.TokenSource = source
+	}
+}
+
+// resolveToken utilise le token fourni comme source si aucune source n'est définie
+func (o *Options) resolveToken(token string) error {
+	if o.TokenSource != nil {
+		return nil
+	}
+	if token == "" {
+		return ErrEmptyToken
+	}
+	o.TokenSource = StaticToken(token)
+	return nil
+}
+
+// WithHeader ajoute un en-tête à chaque requête, par exemple pour un
+// identifiant de tenant ou de trace exigé par une passerelle
+func WithHeader(key string, value string) Option {
+	return func(o *Options) {
+		if key == "" {
+			o.addError(fmt.Errorf("%w: header name cannot be empty", ErrInvalidOption))
+			return
+		}
+		if o.Headers == nil {
+			o.Headers = make(http.Header)
+		}
+		o.Headers.Set(key, value)
+	}
+}
+
+// WithHeaders ajoute plusieurs en-têtes à chaque requête
+func WithHeaders(headers map[string]string) Option {
+	return func(o *Options) {
+		for key, value := range headers {
+			WithHeader(key, value)(o)
+		}
+	}
+}
+
+// WithAppName ajoute le nom de l'application (par exemple "my-app/1.2") à
+// l'en-tête User-Agent
+func WithAppName(name string) Option {
+	return func(o *Options) {
+		o.AppName = name
+	}
+}
+
+// WithRawResponse capture dans raw le corps de la requête envoyée, ainsi que
+// le statut, les en-têtes et le corps (ou les événements SSE) de la réponse
+func WithRawResponse(raw *RawResponse) Option {
+	return func(o *Options) {
+		o.RawResponse = raw
+	}
+}
+
+// WithHTTPClient utilise le client HTTP fourni au lieu de celui construit par
+// le SDK. Son Timeout prime sur WithTimeout s'il est défini (en streaming, il
+// ne limite que l'attente des en-têtes) ; ConnectTimeout ne s'applique pas à
+// son transport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *Options) {
+		if client == nil {
+			o.addError(fmt.Errorf("%w: http client cannot be nil", ErrInvalidOption))
+			return
+		}
+		o.HTTPClient = client
+	}
+}
+
+// WithTransport utilise le transport HTTP fourni (proxy, mock, enregistrement...)
+// au lieu du transport partagé du SDK. Il prime sur le transport de WithHTTPClient.
+// En streaming, WithTimeout limite toujours l'attente des en-têtes de réponse ;
+// ConnectTimeout ne s'applique pas à ce transport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *Options) {
+		if transport == nil {
+			o.addError(fmt.Errorf("%w: transport cannot be nil", ErrInvalidOption))
+			return
+		}
+		o.Transport = transport
+	}
+}
+
+// WithMiddleware ajoute des middlewares autour de chaque tentative de requête
+// HTTP. Le premier middleware ajouté est le plus externe.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *Options) {
+		for _, mw := range middlewares {
+			if mw == nil {
+				o.addError(fmt.Errorf("%w: middleware cannot be nil", ErrInvalidOption))
+				continue
+			}
+			o.Middlewares = append(o.Middlewares, mw)
+		}
+	}
+}
+
 // WithBaseURL définit l'URL de base de l'API
 func WithBaseURL(url string) Option {
 	return func(o *Options) {
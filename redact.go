@@ -0,0 +1,183 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// LogBodyMode détermine ce qui est journalisé des corps de requête et de
+// réponse (attributs body, content et data)
+type LogBodyMode int
+
+const (
+	// LogBodyTruncated journalise les corps tronqués à maxLoggedBody octets
+	LogBodyTruncated LogBodyMode = iota
+
+	// LogBodyMetadata ne journalise que la taille des corps ; les erreurs, dont
+	// le message peut reprendre le corps, sont réduites à leur type et leur taille
+	LogBodyMetadata
+
+	// LogBodyFull journalise les corps complets
+	LogBodyFull
+)
+
+// maxLoggedBody est la taille maximale d'un corps journalisé en mode LogBodyTruncated
+const maxLoggedBody = 512
+
+// redacted remplace les secrets et données personnelles masqués
+const redacted = "[REDACTED]"
+
+// Motifs de masquage prédéfinis, à passer à WithRedact
+var (
+	// RedactEmails masque les adresses email
+	RedactEmails = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+	// RedactPhoneNumbers masque les numéros de téléphone : suites de 9 à 15
+	// chiffres, éventuellement séparés par des espaces, points, tirets ou
+	// parenthèses
+	RedactPhoneNumbers = regexp.MustCompile(`\+?\(?\d(?:[ .()-]{0,2}\d){8,14}`)
+)
+
+// bearerPattern masque les tokens d'authentification Bearer, toujours appliqué
+var bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+
+// bodyKeys sont les attributs de log contenant des corps ou des messages
+var bodyKeys = map[string]bool{"body": true, "content": true, "data": true}
+
+// redactor masque les secrets et les motifs configurés dans les logs
+type redactor struct {
+	patterns []*regexp.Regexp
+	bodyMode LogBodyMode
+
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// newRedactor crée le redactor des options
+func newRedactor(options *Options) *redactor {
+	return &redactor{
+		patterns: options.RedactPatterns,
+		bodyMode: options.LogBody,
+	}
+}
+
+// addSecret enregistre une valeur à masquer partout (token utilisé)
+func (r *redactor) addSecret(secret string) {
+	if r == nil || secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.secrets {
+		if s == secret {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, secret)
+}
+
+// redact masque les secrets, les tokens Bearer et les motifs configurés
+func (r *redactor) redact(s string) string {
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	r.mu.RUnlock()
+
+	s = bearerPattern.ReplaceAllString(s, "${1}"+redacted)
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// attr masque la valeur d'un attribut, et applique le mode de journalisation
+// des corps
+func (r *redactor) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return r.text(a.Key, v.String())
+	case slog.KindGroup:
+		attrs := v.Group()
+		redactedAttrs := make([]any, len(attrs))
+		for i, ga := range attrs {
+			redactedAttrs[i] = r.attr(ga)
+		}
+		return slog.Group(a.Key, redactedAttrs...)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			if r.bodyMode == LogBodyMetadata {
+				// Le message d'une erreur peut contenir un extrait du corps
+				return slog.Group(a.Key, slog.String("type", errorType(x)), slog.Int("bytes", len(x.Error())))
+			}
+			return r.text(a.Key, x.Error())
+		case []byte:
+			return r.text(a.Key, string(x))
+		case fmt.Stringer:
+			return r.text(a.Key, x.String())
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// text masque une valeur texte ; pour les corps, applique le mode de journalisation
+func (r *redactor) text(key, s string) slog.Attr {
+	if !bodyKeys[key] {
+		return slog.String(key, r.redact(s))
+	}
+	switch r.bodyMode {
+	case LogBodyMetadata:
+		return slog.Int(key+"_bytes", len(s))
+	case LogBodyTruncated:
+		s = r.redact(s)
+		if len(s) > maxLoggedBody {
+			s = fmt.Sprintf("%s... (%d bytes)", s[:maxLoggedBody], len(s))
+		}
+		return slog.String(key, s)
+	default:
+		return slog.String(key, r.redact(s))
+	}
+}
+
+// redactHandler est un slog.Handler qui masque les événements avant de les
+// transmettre au handler suivant
+type redactHandler struct {
+	next     slog.Handler
+	redactor *redactor
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	out := slog.NewRecord(record.Time, record.Level, h.redactor.redact(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.redactor.attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redactedAttrs[i] = h.redactor.attr(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(redactedAttrs), redactor: h.redactor}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	decodeErr := newDecodeError([]byte(`{"note":"private"}`), ErrNoContent)
+
+	tests := []struct {
+		name     string
+		patterns []*regexp.Regexp
+		mode     LogBodyMode
+		attr     slog.Attr
+		wantKey  string
+		want     string
+	}{
+		{
+			name: "bearer token",
+			attr: slog.String("error", "header Authorization: Bearer sk-abc.123"),
+			want: "header Authorization: Bearer [REDACTED]",
+		},
+		{
+			name: "secret token",
+			attr: slog.Any("error", errors.New("invalid token secret-token")),
+			want: "invalid token [REDACTED]",
+		},
+		{
+			name:     "email",
+			patterns: []*regexp.Regexp{RedactEmails},
+			attr:     slog.String("content", "write to jane.doe@example.com"),
+			want:     "write to [REDACTED]",
+		},
+		{
+			name:     "phone numbers",
+			patterns: []*regexp.Regexp{RedactPhoneNumbers},
+			mode:     LogBodyFull,
+			attr:     slog.String("body", "call +33 6 12 34 56 78 or (555) 123-4567 before 2024-10-18"),
+			want:     "call [REDACTED] or [REDACTED] before 2024-10-18",
+		},
+		{
+			name:     "custom pattern",
+			patterns: []*regexp.Regexp{regexp.MustCompile(`ACC-\d+`)},
+			attr:     slog.Group("req", slog.String("data", "account ACC-42")),
+			want:     "[data=account [REDACTED]]",
+		},
+		{
+			name:    "metadata only",
+			mode:    LogBodyMetadata,
+			attr:    slog.String("body", "secret message"),
+			wantKey: "body_bytes",
+			want:    "14",
+		},
+		{
+			name: "metadata only error",
+			mode: LogBodyMetadata,
+			attr: slog.Any("error", decodeErr),
+			want: fmt.Sprintf("[type=no_content bytes=%d]", len(decodeErr.Error())),
+		},
+		{
+			name: "truncated body",
+			attr: slog.String("body", strings.Repeat("a", maxLoggedBody+10)),
+			want: strings.Repeat("a", maxLoggedBody) + fmt.Sprintf("... (%d bytes)", maxLoggedBody+10),
+		},
+		{
+			name: "metadata attributes untouched",
+			mode: LogBodyMetadata,
+			attr: slog.Int("status", 200),
+			want: "200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRedactor(&Options{RedactPatterns: tt.patterns, LogBody: tt.mode})
+			r.addSecret("secret-token")
+			got := r.attr(tt.attr)
+			wantKey := tt.wantKey
+			if wantKey == "" {
+				wantKey = tt.attr.Key
+			}
+			if got.Key != wantKey {
+				t.Errorf("expected key %q, got %q", wantKey, got.Key)
+			}
+			if got.Value.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got.Value.String())
+			}
+		})
+	}
+}
+
+func TestLoggerRedaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"Reply to bob@example.com"}}]}`)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, err := Completion(modelNonStream, "", "My email is alice@example.com",
+		WithBaseURL(server.URL),
+		WithTokenSource(StaticToken("sk-live-secret")),
+		WithLogger(logger),
+		WithRedact(RedactEmails),
+		WithLogBody(LogBodyFull),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	for _, leak := range []string{"alice@example.com", "bob@example.com", "sk-live-secret"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("log output leaks %q:\n%s", leak, out)
+		}
+	}
+	if !strings.Contains(out, "My email is [REDACTED]") {
+		t.Errorf("expected redacted request body in logs:\n%s", out)
+	}
+
+	// En mode metadata, aucun extrait de corps n'apparaît, y compris dans les erreurs
+	for _, body := range []string{
+		`{"choices":[],"note":"PRIVATE ANSWER TEXT"}`,
+		`{"error":{"message":"PRIVATE ANSWER TEXT"}}`,
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+		buf.Reset()
+		Completion(modelNonStream, "test-token", "PRIVATE PROMPT",
+			WithBaseURL(server.URL),
+			WithLogger(logger),
+			WithLogBody(LogBodyMetadata),
+		)
+		server.Close()
+		if out := buf.String(); strings.Contains(out, "PRIVATE") {
+			t.Errorf("metadata log output leaks body text:\n%s", out)
+		}
+	}
+
+	for _, opt := range []Option{WithRedact(nil), WithLogBody(LogBodyMode(42))} {
+		if _, err := Completion(modelNonStream, "test-token", "Hello", opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected ErrInvalidOption, got %v", err)
+		}
+	}
+}
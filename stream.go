@@ -9,14 +9,51 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// streamReader gère la lecture d'un stream SSE
+// sseEvent représente un événement Server-Sent Events
+type sseEvent struct {
+	// Type est le type de l'événement (champ "event:", "message" par défaut)
+	Type string
+
+	// Data contient les lignes "data:" de l'événement, séparées par "\n"
+	Data []byte
+
+	// ID est le dernier identifiant reçu (champ "id:"), conservé entre les événements
+	ID string
+
+	// Retry est le délai de reconnexion demandé par le serveur (champ "retry:")
+	Retry time.Duration
+}
+
+// streamReader gère la lecture d'un stream SSE conformément à la spécification
+// HTML (https://html.spec.whatwg.org/multipage/server-sent-events.html)
 type streamReader struct {
 	reader *bufio.Reader
 	buffer bytes.Buffer
+
+	// eventType est le type de l'événement en cours de lecture
+	eventType string
+
+	// lastEventID est le dernier identifiant reçu
+	lastEventID string
+
+	// retry est le dernier délai de reconnexion reçu
+	retry time.Duration
+
+	// started indique si le début du stream (et un éventuel BOM) a été traité
+	started bool
+
+	// pendingCR indique que la dernière ligne s'est terminée par CR : un LF
+	// lu ensuite complète un terminateur CRLF. Il n'est pas attendu, pour ne
+	// pas bloquer sur une connexion ouverte.
+	pendingCR bool
 }
 
 // newStreamReader crée un nouveau lecteur de stream
@@ -26,87 +63,547 @@ func newStreamReader(r io.Reader) *streamReader {
 	}
 }
 
-// readEvent lit le prochain événement SSE
-func (s *streamReader) readEvent() ([]byte, error) {
+// errIncompleteLine signale une ligne non terminée en fin de stream
+var errIncompleteLine = errors.New("incomplete line")
+
+// readLine lit une ligne terminée par CRLF, LF ou CR, sans le terminateur
+func (s *streamReader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				// Ligne incomplète en fin de stream
+				return line, errIncompleteLine
+			}
+			return nil, err
+		}
+		pendingCR := s.pendingCR
+		s.pendingCR = false
+		switch b {
+		case '\n':
+			if pendingCR {
+				// Fin du terminateur CRLF de la ligne précédente
+				continue
+			}
+			return line, nil
+		case '\r':
+			s.pendingCR = true
+			return line, nil
+		}
+		line = append(line, b)
+	}
+}
+
+// readEvent lit le prochain événement SSE. Un événement est émis à chaque
+// ligne vide s'il contient des données ; un événement incomplet en fin de
+// stream est ignoré, comme le prévoit la spécification.
+func (s *streamReader) readEvent() (*sseEvent, error) {
 	s.buffer.Reset()
+	s.eventType = ""
+	hasData := false
+
 	for {
-		line, err := s.reader.ReadBytes('\n')
+		line, err := s.readLine()
 		if err != nil {
-			if err == io.EOF {
-				if s.buffer.Len() > 0 {
-					return s.buffer.Bytes(), nil
-				}
+			if err == errIncompleteLine {
+				return nil, io.EOF
 			}
 			return nil, err
 		}
 
-		// Ignore les commentaires
-		if bytes.HasPrefix(line, []byte(":")) {
-			continue
+		// Un BOM UTF-8 éventuel en début de stream est ignoré
+		if !s.started {
+			s.started = true
+			line = bytes.TrimPrefix(line, []byte("\xEF\xBB\xBF"))
 		}
 
 		// Ligne vide marque la fin d'un événement
-		if len(bytes.TrimSpace(line)) == 0 {
-			if s.buffer.Len() > 0 {
-				return s.buffer.Bytes(), nil
+		if len(line) == 0 {
+			if !hasData {
+				s.eventType = ""
+				continue
+			}
+			event := &sseEvent{
+				Type:  s.eventType,
+				Data:  bytes.Clone(s.buffer.Bytes()),
+				ID:    s.lastEventID,
+				Retry: s.retry,
+			}
+			if event.Type == "" {
+				event.Type = "message"
 			}
+			return event, nil
+		}
+
+		// Ignore les commentaires
+		if line[0] == ':' {
 			continue
 		}
 
-		// Vérifie si c'est une ligne de données
-		if bytes.HasPrefix(line, []byte("data: ")) {
-			data := bytes.TrimPrefix(line, []byte("data: "))
-			data = bytes.TrimSpace(data)
-			s.buffer.Write(data)
+		// Découpage "champ: valeur", un seul espace après ":" est retiré
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], line[i+1:]
+			value = bytes.TrimPrefix(value, []byte(" "))
+		}
+
+		switch string(field) {
+		case "data":
+			if hasData {
+				s.buffer.WriteByte('\n')
+			}
+			s.buffer.Write(value)
+			hasData = true
+		case "event":
+			s.eventType = string(value)
+		case "id":
+			// Un identifiant contenant NUL est ignoré
+			if bytes.IndexByte(value, 0) < 0 {
+				s.lastEventID = string(value)
+			}
+		case "retry":
+			// Seule une valeur composée uniquement de chiffres est acceptée
+			if len(value) > 0 && isDigits(value) {
+				if ms, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+					s.retry = time.Duration(ms) * time.Millisecond
+				}
+			}
+		}
+		// Les autres champs sont ignorés
+	}
+}
+
+// isDigits indique si la valeur ne contient que des chiffres ASCII
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
 		}
 	}
+	return true
+}
+
+// streamState accumule le contenu d'un stream, éventuellement reçu sur
+// plusieurs connexions successives
+type streamState struct {
+	options *Options
+	result  *Result
+
+	// lastEventID est le dernier identifiant d'événement SSE reçu
+	lastEventID string
+
+	// seenIDs contient les identifiants déjà reçus, pour reconnaître un
+	// serveur qui rejoue le stream depuis le début
+	seenIDs map[string]bool
+
+	// firstContent est appelé à la réception du premier contenu
+	firstContent func()
+
+	// choices accumule chaque choix séparément, par index
+	choices map[int]*choiceState
 }
 
-// processStream traite le stream et reconstruit la réponse complète
-func processStream(r io.Reader, options *Options) (string, error) {
-	debugPrint(options, "Starting stream processing")
+// choiceState accumule le contenu d'un choix du stream
+type choiceState struct {
+	Choice
+	content bytes.Buffer
+
+	// checkpoint est la longueur du contenu après l'événement portant
+	// lastEventID : un serveur qui reprend le stream renvoie tout ce qui suit
+	checkpoint int
+
+	// skip est la longueur de contenu rejoué restant à ignorer avant de
+	// dépasser checkpoint
+	skip int
+
+	// delivered est la longueur du contenu déjà transmis au hook OnChunk, qui
+	// ne reçoit pas une seconde fois le contenu renvoyé après une reprise
+	delivered int
+}
+
+// newStreamState crée un accumulateur de stream vide
+func newStreamState(options *Options) *streamState {
+	return &streamState{
+		options: options,
+		result:  &Result{},
+		seenIDs: make(map[string]bool),
+		choices: make(map[int]*choiceState),
+	}
+}
+
+// choice retourne le choix d'index donné, en le créant si nécessaire
+func (st *streamState) choice(index int) *choiceState {
+	c, ok := st.choices[index]
+	if !ok {
+		c = &choiceState{Choice: Choice{Index: index}}
+		st.choices[index] = c
+	}
+	return c
+}
+
+// consume lit les événements du stream jusqu'à sa fin. Les erreurs retournées
+// sont des *StreamError dont le champ Partial n'est pas encore renseigné.
+func (st *streamState) consume(r io.Reader) error {
+	options := st.options
 	reader := newStreamReader(r)
-	var result strings.Builder
+	// Après une reconnexion, le premier identifiant reçu indique si le
+	// serveur reprend après Last-Event-ID ou rejoue le stream depuis le début
+	replayChecked := len(st.seenIDs) == 0
+	for _, c := range st.choices {
+		c.skip = 0
+	}
+	previousID := ""
 
 	for {
-		data, err := reader.readEvent()
-		if len(data) > 0 {
-			debugPrint(options, "Received event: %s", string(data))
-		}
+		event, err := reader.readEvent()
 		if err != nil {
 			if err == io.EOF {
-				break
+				return nil
 			}
-			return "", err
+			return &StreamError{Err: asTimeout(err)}
 		}
+		options.RawResponse.captureEvent(event)
 
-		// Ignore les événements vides ou [DONE]
-		if len(data) == 0 {
-			continue
+		if !replayChecked && event.ID != "" {
+			replayChecked = true
+			if st.seenIDs[event.ID] {
+				options.logger().Debug("stream replayed from start", "event_id", event.ID)
+				st.rewind()
+			}
+		}
+
+		// Un identifiant déjà reçu appartient à un événement rejoué, antérieur
+		// au point de reprise
+		newID := event.ID != "" && event.ID != previousID && !st.seenIDs[event.ID]
+		previousID = event.ID
+		if err := st.handleEvent(event); err != nil {
+			return err
+		}
+		if newID {
+			st.lastEventID = event.ID
+			st.seenIDs[event.ID] = true
+			for _, c := range st.choices {
+				c.checkpoint = c.content.Len()
+			}
 		}
-		if string(data) == "[DONE]" {
-			debugPrint(options, "Received [DONE] event")
+	}
+}
+
+// rewind traite le contenu reçu depuis la reconnexion comme le début d'un
+// stream rejoué : pour chaque choix, seule la partie rejouée au-delà du point
+// de reprise est conservée, et la suite du rejeu est ignorée jusqu'à ce point
+func (st *streamState) rewind() {
+	for _, c := range st.choices {
+		replayed := c.content.Bytes()[c.checkpoint:]
+		if len(replayed) <= c.checkpoint {
+			c.skip = c.checkpoint - len(replayed)
+			c.content.Truncate(c.checkpoint)
 			continue
 		}
+		beyond := bytes.Clone(replayed[c.checkpoint:])
+		c.content.Truncate(c.checkpoint)
+		c.content.Write(beyond)
+	}
+}
+
+// handleEvent traite un événement SSE
+func (st *streamState) handleEvent(event *sseEvent) error {
+	options := st.options
+
+	// Événement d'erreur explicite
+	if event.Type == "error" {
+		return &StreamError{Err: ErrStreamAborted, APIError: parseStreamError(event.Data)}
+	}
+
+	// Seuls les événements "message" transportent des chunks de réponse
+	if event.Type != "message" {
+		options.logger().Debug("event ignored", "event_type", event.Type)
+		return nil
+	}
+
+	// Ignore les événements vides ou [DONE]
+	data := bytes.TrimSpace(event.Data)
+	if len(data) == 0 {
+		return nil
+	}
+	if string(data) == "[DONE]" {
+		return nil
+	}
+
+	// Objet d'erreur envoyé dans un événement de données
+	if apiErr := extractAPIError(data); apiErr != nil {
+		return &StreamError{Err: ErrStreamAborted, APIError: apiErr}
+	}
+
+	// Parse la réponse
+	var resp streamResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		options.logger().Warn("decode error", "error", err, "data", string(data))
+		return &StreamError{Err: ErrStreamCorrupted}
+	}
+
+	result := st.result
+	if resp.ID != "" {
+		result.ID = resp.ID
+	}
+	if resp.Model != "" {
+		result.Model = resp.Model
+	}
+	if resp.Usage != nil {
+		// Envoyé dans le dernier chunk, éventuellement sans choix
+		result.Usage = *resp.Usage
+		options.logger().Debug("usage received", "prompt_tokens", resp.Usage.PromptTokens,
+			"completion_tokens", resp.Usage.CompletionTokens)
+	}
+
+	// Ajoute le contenu au résultat
+	for _, choice := range resp.Choices {
+		c := st.choice(choice.Index)
+		if choice.Delta.Role != "" {
+			c.Role = choice.Delta.Role
+		}
+		content := choice.Delta.Content
+		if c.skip > 0 && content != "" {
+			// Contenu rejoué, déjà reçu avant le point de reprise
+			n := min(c.skip, len(content))
+			c.skip -= n
+			options.logger().Debug("replayed chunk skipped", "choice", choice.Index, "content", content[:n])
+			content = content[n:]
+		}
+		if content != "" {
+			if st.firstContent != nil {
+				st.firstContent()
+				st.firstContent = nil
+			}
+			c.content.WriteString(content)
+			options.logger().Debug("chunk received", "choice", choice.Index, "content", content)
+			st.deliver(c)
+		}
+		if choice.FinishReason != "" {
+			c.FinishReason = choice.FinishReason
+		}
+	}
+	return nil
+}
+
+// empty indique si aucun contenu n'a été reçu, pour aucun choix
+func (st *streamState) empty() bool {
+	for _, c := range st.choices {
+		if c.content.Len() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// deliver transmet au hook OnChunk le contenu du choix qui ne lui a pas
+// encore été transmis
+func (st *streamState) deliver(c *choiceState) {
+	if c.content.Len() <= c.delivered {
+		return
+	}
+	content := string(c.content.Bytes()[c.delivered:])
+	c.delivered = c.content.Len()
+	st.options.Hooks.chunk(c.Index, content)
+}
+
+// finish retourne le résultat accumulé, accompagné de l'erreur éventuelle
+func (st *streamState) finish(err error) (*Result, error) {
+	result := st.result
+	result.Choices = result.Choices[:0]
+	for _, c := range st.choices {
+		c.Content = c.content.String()
+		result.Choices = append(result.Choices, c.Choice)
+	}
+	sort.Slice(result.Choices, func(i, j int) bool {
+		return result.Choices[i].Index < result.Choices[j].Index
+	})
+	result.syncFirstChoice()
+	if err == nil {
+		st.options.logger().Debug("stream done", "choices", len(result.Choices),
+			"finish_reason", result.FinishReason, "content_length", len(result.Content))
+		return st.result, nil
+	}
+
+	st.options.logger().Warn("stream interrupted", "error", err, "content_length", len(result.Content))
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) {
+		streamErr = &StreamError{Err: err}
+	}
+	streamErr.Partial = st.result
+	return st.result, streamErr
+}
+
+// isResumable indique si une interruption de stream est due au transport, et
+// peut donc être reprise (par opposition à une erreur envoyée par le serveur)
+func isResumable(err error) bool {
+	return err != nil &&
+		!errors.Is(err, ErrStreamCorrupted) &&
+		!errors.Is(err, ErrStreamAborted)
+}
+
+// streamHooks relie le traitement d'un stream à la requête HTTP en cours
+type streamHooks struct {
+	// firstContent est appelé à la réception du premier contenu
+	firstContent func()
+
+	// reconnect rouvre le stream après l'événement lastEventID (en-tête Last-Event-ID)
+	reconnect func(lastEventID string) (io.ReadCloser, error)
+
+	// continueFrom demande au modèle la suite du contenu partiel, avec au plus
+	// remaining reprises supplémentaires
+	continueFrom func(partial string, remaining int) (*Result, error)
+
+	// restart renvoie la requête d'origine, avec au plus remaining reprises
+	// supplémentaires, lorsqu'aucun contenu n'a été reçu
+	restart func(remaining int) (*Result, error)
+}
+
+// processStream traite le stream et reconstruit la réponse complète. En cas
+// d'erreur, le résultat partiel reçu jusque-là est retourné avec une *StreamError.
+func processStream(r io.Reader, options *Options) (*Result, error) {
+	return readStream(r, options, nil)
+}
+
+// readStream traite le stream comme processStream, et reprend les
+// interruptions de transport (au plus options.MaxResumes fois) : par
+// reconnexion avec Last-Event-ID si le serveur numérote ses événements, sinon
+// par une requête de continuation dont le début redondant est supprimé (ce
+// repli n'est possible que pour une réponse à un seul choix). Si aucun contenu
+// n'a été reçu, la requête d'origine est simplement renvoyée.
+func readStream(r io.Reader, options *Options, hooks *streamHooks) (*Result, error) {
+	st := newStreamState(options)
+	if hooks != nil {
+		st.firstContent = hooks.firstContent
+	}
+	err := st.consume(r)
+
+	for resumes := 0; hooks != nil && isResumable(err) && resumes < options.MaxResumes; resumes++ {
+		if options.ctx.Err() != nil {
+			// Deadline dépassée : inutile de reprendre
+			break
+		}
+		options.logger().Info("stream resume", "error", err, "resume", resumes+1, "max_resumes", options.MaxResumes)
 
-		// Parse la réponse
-		var resp streamResponse
-		if err := json.Unmarshal(data, &resp); err != nil {
-			debugPrint(options, "Error parsing stream response: %v", err)
-			return "", ErrStreamCorrupted
+		// Reconnexion avec Last-Event-ID
+		if st.lastEventID != "" {
+			body, rerr := hooks.reconnect(st.lastEventID)
+			if rerr == nil {
+				options.logger().Debug("stream reconnected", "event_id", st.lastEventID)
+				for _, c := range st.choices {
+					c.content.Truncate(c.checkpoint)
+				}
+				err = st.consume(body)
+				body.Close()
+				continue
+			}
+			options.logger().Warn("stream reconnection failed", "error", rerr)
 		}
-		debugJSON(options, "Parsed stream response", resp)
 
-		// Ajoute le contenu au résultat
-		for _, choice := range resp.Choices {
-			if choice.Delta.Content != "" {
-				result.WriteString(choice.Delta.Content)
-				debugPrint(options, "Added content: %q", choice.Delta.Content)
+		// Aucun contenu reçu : il n'y a rien à continuer, la requête est renvoyée
+		if st.empty() {
+			options.logger().Info("stream restarted", "choices", len(st.choices))
+			next, rerr := hooks.restart(options.MaxResumes - resumes - 1)
+			if next != nil {
+				return next, rerr
 			}
+			err = rerr
+			break
+		}
+
+		// Repli : requête de continuation, possible pour un seul choix
+		if len(st.choices) > 1 {
+			options.logger().Warn("stream cannot be continued", "choices", len(st.choices))
+			break
+		}
+		first := st.choice(0)
+		partial := first.content.String()
+		next, cerr := hooks.continueFrom(partial, options.MaxResumes-resumes-1)
+		if next != nil {
+			first.content.Reset()
+			first.content.WriteString(mergeOverlap(partial, next.Content))
+			st.deliver(first)
+			first.FinishReason = next.FinishReason
+			st.result.Usage.add(next.Usage)
+			st.result.UsageEstimated = st.result.UsageEstimated || next.UsageEstimated
 		}
+		err = cerr
+		break
 	}
 
-	finalResult := result.String()
-	debugPrint(options, "Stream processing completed, final result: %q", finalResult)
-	return finalResult, nil
+	return st.finish(err)
+}
+
+// minOverlap est la longueur minimale d'un chevauchement supprimé par
+// mergeOverlap, pour ne pas fusionner des caractères identiques par hasard
+const minOverlap = 8
+
+// mergeOverlap concatène deux textes en supprimant le début de next qui
+// répète la fin de prev
+func mergeOverlap(prev, next string) string {
+	max := len(prev)
+	if len(next) < max {
+		max = len(next)
+	}
+	for k := max; k >= minOverlap; k-- {
+		if strings.HasSuffix(prev, next[:k]) {
+			return prev + next[k:]
+		}
+	}
+	return prev + next
+}
+
+// extractAPIError retourne l'erreur contenue dans un chunk de la forme
+// {"error": ...}, ou nil si le chunk n'en contient pas
+func extractAPIError(data []byte) *APIError {
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil
+	}
+	if len(envelope.Error) == 0 || string(envelope.Error) == "null" {
+		return nil
+	}
+	apiErr := decodeAPIError(envelope.Error)
+	apiErr.Raw = json.RawMessage(bytes.Clone(data))
+	return apiErr
+}
+
+// parseStreamError décode les données d'un événement "error"
+func parseStreamError(data []byte) *APIError {
+	if apiErr := extractAPIError(data); apiErr != nil {
+		return apiErr
+	}
+	apiErr := decodeAPIError(data)
+	apiErr.Raw = json.RawMessage(bytes.Clone(data))
+	return apiErr
+}
+
+// decodeAPIError décode une erreur serveur, sous forme d'objet ou de texte
+func decodeAPIError(data []byte) *APIError {
+	var payload struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Code    json.RawMessage `json:"code"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		// Erreur sous forme de chaîne JSON ou de texte brut
+		var text string
+		if json.Unmarshal(data, &text) != nil {
+			text = string(bytes.TrimSpace(data))
+		}
+		return &APIError{Message: text}
+	}
+
+	code := string(payload.Code)
+	var strCode string
+	if json.Unmarshal(payload.Code, &strCode) == nil {
+		code = strCode
+	}
+	if code == "null" {
+		code = ""
+	}
+	return &APIError{Message: payload.Message, Type: payload.Type, Code: code}
 }
@@ -7,81 +7,221 @@ package aiyou
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestStreamReader(t *testing.T) {
 	tests := []struct {
-		name    string
-		input   string
-		want    []string
-		wantErr bool
+		name  string
+		input string
+		want  []sseEvent
 	}{
 		{
 			name:  "simple event",
 			input: "data: {\"content\":\"Hello\"}\n\n",
-			want:  []string{"{\"content\":\"Hello\"}"},
+			want:  []sseEvent{{Type: "message", Data: []byte("{\"content\":\"Hello\"}")}},
 		},
 		{
 			name: "multiple events",
 			input: "data: {\"content\":\"Hello\"}\n\n" +
 				"data: {\"content\":\"World\"}\n\n",
-			want: []string{
-				"{\"content\":\"Hello\"}",
-				"{\"content\":\"World\"}",
+			want: []sseEvent{
+				{Type: "message", Data: []byte("{\"content\":\"Hello\"}")},
+				{Type: "message", Data: []byte("{\"content\":\"World\"}")},
 			},
 		},
 		{
 			name: "with comments",
 			input: ": keep-alive\n" +
 				"data: {\"content\":\"Hello\"}\n\n",
-			want: []string{"{\"content\":\"Hello\"}"},
+			want: []sseEvent{{Type: "message", Data: []byte("{\"content\":\"Hello\"}")}},
 		},
 		{
 			name: "with empty lines",
 			input: "\n" +
 				"data: {\"content\":\"Hello\"}\n\n" +
 				"\n",
-			want: []string{"{\"content\":\"Hello\"}"},
+			want: []sseEvent{{Type: "message", Data: []byte("{\"content\":\"Hello\"}")}},
 		},
 		{
 			name:  "empty input",
 			input: "",
-			want:  []string{},
+			want:  nil,
+		},
+		{
+			name:  "multi-line data joined with newline",
+			input: "data: first\ndata: second\ndata\ndata: third\n\n",
+			want:  []sseEvent{{Type: "message", Data: []byte("first\nsecond\n\nthird")}},
+		},
+		{
+			name:  "data without space",
+			input: "data:Hello\n\n",
+			want:  []sseEvent{{Type: "message", Data: []byte("Hello")}},
+		},
+		{
+			name:  "only one leading space removed",
+			input: "data:  Hello \n\n",
+			want:  []sseEvent{{Type: "message", Data: []byte(" Hello ")}},
+		},
+		{
+			name:  "CRLF line endings",
+			input: "data: Hello\r\ndata: World\r\n\r\n",
+			want:  []sseEvent{{Type: "message", Data: []byte("Hello\nWorld")}},
+		},
+		{
+			name:  "CR line endings",
+			input: "data: Hello\rdata: World\r\r",
+			want:  []sseEvent{{Type: "message", Data: []byte("Hello\nWorld")}},
+		},
+		{
+			name:  "byte order mark",
+			input: "\xEF\xBB\xBFdata: Hello\n\n",
+			want:  []sseEvent{{Type: "message", Data: []byte("Hello")}},
+		},
+		{
+			name:  "event type",
+			input: "event: error\ndata: boom\n\ndata: next\n\n",
+			want: []sseEvent{
+				{Type: "error", Data: []byte("boom")},
+				{Type: "message", Data: []byte("next")},
+			},
+		},
+		{
+			name:  "event type without data is discarded",
+			input: "event: ping\n\ndata: Hello\n\n",
+			want:  []sseEvent{{Type: "message", Data: []byte("Hello")}},
+		},
+		{
+			name:  "id persists across events",
+			input: "id: 1\ndata: a\n\ndata: b\n\nid: 3\ndata: c\n\n",
+			want: []sseEvent{
+				{Type: "message", Data: []byte("a"), ID: "1"},
+				{Type: "message", Data: []byte("b"), ID: "1"},
+				{Type: "message", Data: []byte("c"), ID: "3"},
+			},
+		},
+		{
+			name:  "empty id resets last event id",
+			input: "id: 1\ndata: a\n\nid\ndata: b\n\n",
+			want: []sseEvent{
+				{Type: "message", Data: []byte("a"), ID: "1"},
+				{Type: "message", Data: []byte("b"), ID: ""},
+			},
+		},
+		{
+			name:  "id containing NUL is ignored",
+			input: "id: 1\ndata: a\n\nid: 2\x003\ndata: b\n\n",
+			want: []sseEvent{
+				{Type: "message", Data: []byte("a"), ID: "1"},
+				{Type: "message", Data: []byte("b"), ID: "1"},
+			},
+		},
+		{
+			name:  "retry",
+			input: "retry: 1500\ndata: a\n\nretry: abc\ndata: b\n\n",
+			want: []sseEvent{
+				{Type: "message", Data: []byte("a"), Retry: 1500 * time.Millisecond},
+				{Type: "message", Data: []byte("b"), Retry: 1500 * time.Millisecond},
+			},
+		},
+		{
+			name:  "unknown fields ignored",
+			input: "foo: bar\ndata: Hello\n\n",
+			want:  []sseEvent{{Type: "message", Data: []byte("Hello")}},
+		},
+		{
+			name:  "incomplete event at end of stream discarded",
+			input: "data: Hello\n\ndata: partial\n",
+			want:  []sseEvent{{Type: "message", Data: []byte("Hello")}},
+		},
+		{
+			name:  "empty data line dispatches empty event",
+			input: "data\n\n",
+			want:  []sseEvent{{Type: "message", Data: []byte("")}},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reader := newStreamReader(strings.NewReader(tt.input))
-			var got []string
+			var got []sseEvent
 
 			for {
-				data, err := reader.readEvent()
+				event, err := reader.readEvent()
 				if err != nil {
-					if len(data) > 0 {
-						got = append(got, string(data))
+					if err != io.EOF {
+						t.Fatalf("unexpected error: %v", err)
 					}
 					break
 				}
-				got = append(got, string(data))
+				got = append(got, *event)
 			}
 
 			if len(got) != len(tt.want) {
-				t.Errorf("got %d events, want %d", len(got), len(tt.want))
-				return
+				t.Fatalf("got %d events, want %d: %+v", len(got), len(tt.want), got)
 			}
 
 			for i := range got {
-				if got[i] != tt.want[i] {
-					t.Errorf("event %d: got %q, want %q", i, got[i], tt.want[i])
+				if got[i].Type != tt.want[i].Type ||
+					!bytes.Equal(got[i].Data, tt.want[i].Data) ||
+					got[i].ID != tt.want[i].ID ||
+					got[i].Retry != tt.want[i].Retry {
+					t.Errorf("event %d: got %+v (data %q), want %+v (data %q)",
+						i, got[i], got[i].Data, tt.want[i], tt.want[i].Data)
 				}
 			}
 		})
 	}
 }
 
+func TestStreamReaderCRDoesNotWait(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	reader := newStreamReader(pr)
+
+	events := make(chan *sseEvent)
+	go func() {
+		defer close(events)
+		for {
+			event, err := reader.readEvent()
+			if err != nil {
+				return
+			}
+			events <- event
+		}
+	}()
+
+	// L'événement terminé par CR est émis sans attendre l'octet suivant
+	go pw.Write([]byte("data: Hello\r\r"))
+	select {
+	case event := <-events:
+		if string(event.Data) != "Hello" {
+			t.Errorf("expected Hello, got %q", event.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event terminated by CR not delivered")
+	}
+
+	// Le LF qui suit complète le terminateur CRLF précédent
+	go pw.Write([]byte("\ndata: World\r\n\r\n"))
+	select {
+	case event := <-events:
+		if string(event.Data) != "World" {
+			t.Errorf("expected World, got %q", event.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second event not delivered")
+	}
+}
+
 func TestProcessStream(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -109,6 +249,12 @@ func TestProcessStream(t *testing.T) {
 			input:   "data: {invalid json}\n\n",
 			wantErr: true,
 		},
+		{
+			name: "ignores non-message events",
+			input: "event: ping\ndata: {}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n",
+			want: "Hello",
+		},
 		{
 			name:  "empty choices",
 			input: "data: {\"choices\":[]}\n\n",
@@ -142,8 +288,8 @@ func TestProcessStream(t *testing.T) {
 				return
 			}
 
-			if got != tt.want {
-				t.Errorf("got %q, want %q", got, tt.want)
+			if got.Content != tt.want {
+				t.Errorf("got %q, want %q", got.Content, tt.want)
 			}
 		})
 	}
@@ -170,3 +316,392 @@ func TestWithDebug(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessStreamErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantErr     error
+		wantPartial string
+		wantAPIErr  *APIError
+	}{
+		{
+			name: "error object in data",
+			input: "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+				"data: {\"error\":{\"message\":\"model overloaded\",\"type\":\"server_error\",\"code\":503}}\n\n",
+			wantErr:     ErrStreamAborted,
+			wantPartial: "Hello",
+			wantAPIErr:  &APIError{Message: "model overloaded", Type: "server_error", Code: "503"},
+		},
+		{
+			name: "error string in data",
+			input: "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+				"data: {\"error\":\"context length exceeded\"}\n\n",
+			wantErr:     ErrStreamAborted,
+			wantPartial: "Hi",
+			wantAPIErr:  &APIError{Message: "context length exceeded"},
+		},
+		{
+			name: "error event",
+			input: "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+				"event: error\ndata: {\"message\":\"internal error\",\"code\":\"internal\"}\n\n",
+			wantErr:     ErrStreamAborted,
+			wantPartial: "Hello",
+			wantAPIErr:  &APIError{Message: "internal error", Code: "internal"},
+		},
+		{
+			name:        "error event with plain text",
+			input:       "event: error\ndata: something went wrong\n\n",
+			wantErr:     ErrStreamAborted,
+			wantPartial: "",
+			wantAPIErr:  &APIError{Message: "something went wrong"},
+		},
+		{
+			name: "corrupted chunk keeps partial",
+			input: "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+				"data: {invalid json}\n\n",
+			wantErr:     ErrStreamCorrupted,
+			wantPartial: "Hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := processStream(strings.NewReader(tt.input), defaultOptions())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			var streamErr *StreamError
+			if !errors.As(err, &streamErr) {
+				t.Fatalf("expected *StreamError, got %T", err)
+			}
+			if got == nil || got.Content != tt.wantPartial {
+				t.Errorf("expected partial result %q, got %+v", tt.wantPartial, got)
+			}
+			if streamErr.Partial != got {
+				t.Error("expected StreamError.Partial to be the returned result")
+			}
+
+			if tt.wantAPIErr == nil {
+				if streamErr.APIError != nil {
+					t.Errorf("unexpected API error: %v", streamErr.APIError)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected *APIError in chain, got %v", err)
+			}
+			if apiErr.Message != tt.wantAPIErr.Message || apiErr.Type != tt.wantAPIErr.Type || apiErr.Code != tt.wantAPIErr.Code {
+				t.Errorf("expected API error %+v, got %+v", tt.wantAPIErr, apiErr)
+			}
+			if len(apiErr.Raw) == 0 {
+				t.Error("expected raw payload to be kept")
+			}
+		})
+	}
+}
+
+// dropConnection coupe brutalement la connexion après avoir envoyé les données déjà écrites
+func dropConnection(t *testing.T, w http.ResponseWriter) {
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestStreamResume(t *testing.T) {
+	chunk := func(id, content string) string {
+		event := ""
+		if id != "" {
+			event = "id: " + id + "\n"
+		}
+		return event + fmt.Sprintf("data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", content)
+	}
+
+	tests := []struct {
+		name     string
+		handlers []func(t *testing.T, w http.ResponseWriter, r *http.Request)
+		want     string
+	}{
+		{
+			name: "reconnect with Last-Event-ID",
+			handlers: []func(t *testing.T, w http.ResponseWriter, r *http.Request){
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("1", "Hello"), chunk("2", " wor"))
+					dropConnection(t, w)
+				},
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					if got := r.Header.Get("Last-Event-ID"); got != "2" {
+						t.Errorf("expected Last-Event-ID 2, got %q", got)
+					}
+					fmt.Fprint(w, chunk("3", "ld"), "data: [DONE]\n\n")
+				},
+			},
+			want: "Hello world",
+		},
+		{
+			name: "events after last id are resent",
+			handlers: []func(t *testing.T, w http.ResponseWriter, r *http.Request){
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("1", "Hello"), chunk("", " wor"))
+					dropConnection(t, w)
+				},
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("2", " wor"), chunk("3", "ld"), "data: [DONE]\n\n")
+				},
+			},
+			want: "Hello world",
+		},
+		{
+			name: "server replaying from start",
+			handlers: []func(t *testing.T, w http.ResponseWriter, r *http.Request){
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("1", "Hello"), chunk("2", " wor"))
+					dropConnection(t, w)
+				},
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("1", "Hello"), chunk("2", " wor"), chunk("3", "ld"), "data: [DONE]\n\n")
+				},
+			},
+			want: "Hello world",
+		},
+		{
+			name: "server replaying events with and without ids",
+			handlers: []func(t *testing.T, w http.ResponseWriter, r *http.Request){
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("1", "Hello"), chunk("", " wor"))
+					dropConnection(t, w)
+				},
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("1", "Hello"), chunk("", " wor"), chunk("2", "ld"), "data: [DONE]\n\n")
+				},
+			},
+			want: "Hello world",
+		},
+		{
+			name: "server replaying content sent before the first id",
+			handlers: []func(t *testing.T, w http.ResponseWriter, r *http.Request){
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("", "Hel"), chunk("1", "lo"), chunk("", " wor"))
+					dropConnection(t, w)
+				},
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("", "Hel"), chunk("1", "lo"), chunk("", " wor"), chunk("2", "ld"), "data: [DONE]\n\n")
+				},
+			},
+			want: "Hello world",
+		},
+		{
+			name: "drop before the first token resends the request",
+			handlers: []func(t *testing.T, w http.ResponseWriter, r *http.Request){
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+					dropConnection(t, w)
+				},
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					var req apiRequest
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Fatal(err)
+					}
+					if len(req.Messages) != 1 || req.Messages[0].Content[0].Text != "Hello" {
+						t.Errorf("expected the original messages, got %+v", req.Messages)
+					}
+					fmt.Fprint(w, chunk("", "Hello world"), "data: [DONE]\n\n")
+				},
+			},
+			want: "Hello world",
+		},
+		{
+			name: "fallback to continuation without ids",
+			handlers: []func(t *testing.T, w http.ResponseWriter, r *http.Request){
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, chunk("", "The quick brown fox"))
+					dropConnection(t, w)
+				},
+				func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+					var req apiRequest
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Fatal(err)
+					}
+					if len(req.Messages) != 3 || req.Messages[1].Content[0].Text != "The quick brown fox" {
+						t.Errorf("unexpected continuation messages: %+v", req.Messages)
+					}
+					fmt.Fprint(w, chunk("", "quick brown fox jumps."), "data: [DONE]\n\n")
+				},
+			},
+			want: "The quick brown fox jumps.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests >= len(tt.handlers) {
+					t.Errorf("unexpected request %d", requests+1)
+					return
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				handler := tt.handlers[requests]
+				requests++
+				handler(t, w, r)
+			}))
+			defer server.Close()
+
+			got, err := Completion(modelStream, "test-token", "Hello",
+				WithBaseURL(server.URL), WithStream(true), WithStreamResume(2))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if requests != len(tt.handlers) {
+				t.Errorf("expected %d requests, got %d", len(tt.handlers), requests)
+			}
+		})
+	}
+}
+
+func TestStreamResumeDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "id: 1\ndata: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+		dropConnection(t, w)
+	}))
+	defer server.Close()
+
+	got, err := Completion(modelStream, "test-token", "Hello", WithBaseURL(server.URL), WithStream(true))
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) {
+		t.Fatalf("expected *StreamError, got %v", err)
+	}
+	if got != "Hello" {
+		t.Errorf("expected partial content %q, got %q", "Hello", got)
+	}
+}
+
+func TestMergeOverlap(t *testing.T) {
+	tests := []struct {
+		prev, next, want string
+	}{
+		{"The quick brown fox", "brown fox jumps", "The quick brown fox jumps"},
+		{"The quick brown fox", " jumps", "The quick brown fox jumps"},
+		{"Hello", "o world", "Helloo world"},
+		{"", "Hello", "Hello"},
+		{"Hello", "", "Hello"},
+	}
+
+	for _, tt := range tests {
+		if got := mergeOverlap(tt.prev, tt.next); got != tt.want {
+			t.Errorf("mergeOverlap(%q, %q) = %q, want %q", tt.prev, tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestProcessStreamAggregation(t *testing.T) {
+	input := "data: {\"id\":\"chatcmpl-1\",\"model\":\"llama\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hello\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"model\":\"llama\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"!\"},\"finish_reason\":\"stop\"}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"model\":\"llama\",\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":2,\"total_tokens\":14}}\n\n" +
+		"data: [DONE]\n\n"
+
+	got, err := processStream(strings.NewReader(input), defaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := &Result{
+		ID:           "chatcmpl-1",
+		Model:        "llama",
+		Role:         "assistant",
+		Content:      "Hello!",
+		FinishReason: FinishReasonStop,
+		Usage:        Usage{PromptTokens: 12, CompletionTokens: 2, TotalTokens: 14},
+	}
+	if got.ID != want.ID || got.Model != want.Model || got.Role != want.Role ||
+		got.Content != want.Content || got.FinishReason != want.FinishReason || got.Usage != want.Usage {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if len(got.Choices) != 1 || got.Choices[0].FinishReason != FinishReasonStop || got.Choices[0].Role != "assistant" {
+		t.Errorf("unexpected choices: %+v", got.Choices)
+	}
+}
+
+func TestStreamUsage(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		sendUsage     bool
+		wantEstimated bool
+	}{
+		{"usage requested", []Option{WithStreamUsage(true)}, true, false},
+		{"usage estimated", nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req apiRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatal(err)
+				}
+				if got := req.StreamOptions != nil && req.StreamOptions.IncludeUsage; got != tt.sendUsage {
+					t.Errorf("expected include_usage %v, got %v", tt.sendUsage, got)
+				}
+				fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hello world\"},\"finish_reason\":\"stop\"}]}\n\n")
+				if tt.sendUsage {
+					fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2,\"total_tokens\":7}}\n\n")
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+
+			got, err := CompletionWithResult(modelStream, "test-token", "Say hello world",
+				append(tt.opts, WithBaseURL(server.URL), WithStream(true))...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.UsageEstimated != tt.wantEstimated {
+				t.Errorf("expected UsageEstimated %v, got %v", tt.wantEstimated, got.UsageEstimated)
+			}
+			if got.Usage.TotalTokens == 0 || got.Usage.TotalTokens != got.Usage.PromptTokens+got.Usage.CompletionTokens {
+				t.Errorf("inconsistent usage: %+v", got.Usage)
+			}
+			if got.FinishReason != FinishReasonStop || got.Role != "assistant" {
+				t.Errorf("unexpected finish reason %q or role %q", got.FinishReason, got.Role)
+			}
+		})
+	}
+}
+
+func TestProcessStreamMultipleChoices(t *testing.T) {
+	input := "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Red\"}},{\"index\":1,\"delta\":{\"role\":\"assistant\",\"content\":\"Blue\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":1,\"delta\":{\"content\":\" sky\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" apple\"},\"finish_reason\":\"stop\"}]}\n\n" +
+		"data: {\"choices\":[{\"index\":1,\"delta\":{},\"finish_reason\":\"length\"}]}\n\n" +
+		"data: [DONE]\n\n"
+
+	got, err := processStream(strings.NewReader(input), defaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Choice{
+		{Index: 0, Role: "assistant", Content: "Red apple", FinishReason: FinishReasonStop},
+		{Index: 1, Role: "assistant", Content: "Blue sky", FinishReason: FinishReasonLength},
+	}
+	if len(got.Choices) != len(want) {
+		t.Fatalf("expected %d choices, got %+v", len(want), got.Choices)
+	}
+	for i := range want {
+		if got.Choices[i] != want[i] {
+			t.Errorf("choice %d: expected %+v, got %+v", i, want[i], got.Choices[i])
+		}
+	}
+	if got.Content != "Red apple" || got.FinishReason != FinishReasonStop {
+		t.Errorf("expected first choice in result, got %q (%s)", got.Content, got.FinishReason)
+	}
+}
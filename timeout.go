@@ -0,0 +1,347 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// transportKey identifie une configuration de transport HTTP
+type transportKey struct {
+	connectTimeout        time.Duration
+	responseHeaderTimeout time.Duration
+}
+
+// transports conserve les transports créés, pour réutiliser les connexions
+// d'un appel à l'autre
+var transports sync.Map
+
+// getTransport retourne un transport HTTP partagé pour la configuration donnée
+func getTransport(key transportKey) http.RoundTripper {
+	if key == (transportKey{}) {
+		return http.DefaultTransport
+	}
+	if t, ok := transports.Load(key); ok {
+		return t.(http.RoundTripper)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if key.connectTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   key.connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = key.connectTimeout
+	}
+	transport.ResponseHeaderTimeout = key.responseHeaderTimeout
+
+	t, _ := transports.LoadOrStore(key, transport)
+	return t.(http.RoundTripper)
+}
+
+// newHTTPClient crée le client HTTP d'un appel. En mode streaming, Timeout ne
+// limite que l'attente des en-têtes de réponse : la durée du stream est
+// contrôlée par FirstTokenTimeout, IdleTimeout et Deadline.
+func newHTTPClient(options *Options, stream bool) *http.Client {
+	if options.HTTPClient != nil {
+		return customHTTPClient(options, stream)
+	}
+
+	key := transportKey{connectTimeout: options.ConnectTimeout}
+	transport := options.Transport
+	if stream {
+		key.responseHeaderTimeout = options.Timeout
+		if transport == nil {
+			transport = getTransport(key)
+		} else {
+			transport = withHeaderTimeout(transport, options.Timeout)
+		}
+		return &http.Client{Transport: transport}
+	}
+	if transport == nil {
+		transport = getTransport(key)
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   options.Timeout,
+	}
+}
+
+// customHTTPClient copie le client fourni par WithHTTPClient, en lui
+// appliquant Transport et Timeout s'il n'en a pas
+func customHTTPClient(options *Options, stream bool) *http.Client {
+	client := *options.HTTPClient
+	if options.Transport != nil {
+		client.Transport = options.Transport
+	}
+	if stream {
+		// La durée du stream est contrôlée par le watchdog et Deadline : le
+		// délai du client ne limite que l'attente des en-têtes
+		timeout := client.Timeout
+		if timeout == 0 {
+			timeout = options.Timeout
+		}
+		client.Transport = withHeaderTimeout(client.Transport, timeout)
+		client.Timeout = 0
+	} else if client.Timeout == 0 {
+		client.Timeout = options.Timeout
+	}
+	return &client
+}
+
+// headerTimeoutTransport limite l'attente des en-têtes de réponse quel que
+// soit le transport sous-jacent, qui peut être fourni par l'application
+// (WithTransport, WithHTTPClient) et ne pas définir ResponseHeaderTimeout
+type headerTimeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// withHeaderTimeout applique le délai d'attente des en-têtes au transport
+// donné (http.DefaultTransport s'il est nil) ; sans délai, il est inchangé
+func withHeaderTimeout(next http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	if timeout <= 0 {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &headerTimeoutTransport{next: next, timeout: timeout}
+}
+
+// RoundTrip envoie la requête en annulant son contexte si les en-têtes ne
+// sont pas reçus à temps ; le contexte reste actif pendant la lecture du corps
+func (t *headerTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(t.timeout, func() {
+		cancel(fmt.Errorf("%w: no response headers received within %v", ErrTimeout, t.timeout))
+	})
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && err == nil {
+		// Délai expiré juste après la réception des en-têtes
+		resp.Body.Close()
+		err = context.Cause(ctx)
+	}
+	if err != nil {
+		if cause := context.Cause(ctx); errors.Is(cause, ErrTimeout) {
+			err = cause
+		}
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody libère le contexte de la requête à la fermeture du corps
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelCauseFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
+
+// withDeadline applique Deadline aux options et retourne la fonction de libération
+func withDeadline(options *Options) context.CancelFunc {
+	if options.Deadline <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(options.ctx, options.Deadline)
+	options.ctx = ctx
+	return cancel
+}
+
+// asTimeout rattache les erreurs de délai dépassé à ErrTimeout
+func asTimeout(err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) {
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// sleep attend le délai donné, ou l'expiration du contexte
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return asTimeout(ctx.Err())
+	}
+}
+
+// watchdog applique les délais de premier token et d'inactivité à la lecture
+// d'un stream : à expiration, le corps de la réponse est fermé et les lectures
+// retournent ErrTimeout
+type watchdog struct {
+	mu sync.Mutex
+
+	// firstTokenDeadline est l'heure limite de réception du premier token
+	firstTokenDeadline time.Time
+
+	// idle est le délai maximum entre deux lectures
+	idle time.Duration
+
+	// lastActivity est l'heure de la dernière lecture
+	lastActivity time.Time
+
+	gotToken bool
+	body     io.ReadCloser
+	timer    *time.Timer
+	err      error
+}
+
+// newWatchdog crée un watchdog pour une requête envoyée à start
+func newWatchdog(options *Options, start time.Time) *watchdog {
+	w := &watchdog{
+		idle:         options.IdleTimeout,
+		lastActivity: time.Now(),
+	}
+	if options.FirstTokenTimeout > 0 {
+		w.firstTokenDeadline = start.Add(options.FirstTokenTimeout)
+	}
+	return w
+}
+
+// watch place le corps de réponse sous surveillance
+func (w *watchdog) watch(body io.ReadCloser) io.ReadCloser {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.body = body
+	w.err = nil
+	w.lastActivity = time.Now()
+	w.arm()
+	return &watchedBody{w: w, body: body}
+}
+
+// firstToken signale la réception du premier token de contenu
+func (w *watchdog) firstToken() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.gotToken {
+		w.gotToken = true
+		w.arm()
+	}
+}
+
+// activity signale une lecture réussie
+func (w *watchdog) activity() {
+	if w.idle <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastActivity = time.Now()
+	w.arm()
+}
+
+// next retourne la prochaine échéance et l'erreur associée ; doit être appelé verrouillé
+func (w *watchdog) next() (time.Time, error) {
+	var deadline time.Time
+	var err error
+	if w.idle > 0 {
+		deadline = w.lastActivity.Add(w.idle)
+		err = fmt.Errorf("%w: no data received for %v", ErrTimeout, w.idle)
+	}
+	if !w.gotToken && !w.firstTokenDeadline.IsZero() &&
+		(deadline.IsZero() || w.firstTokenDeadline.Before(deadline)) {
+		deadline = w.firstTokenDeadline
+		err = fmt.Errorf("%w: no token received before first token deadline", ErrTimeout)
+	}
+	return deadline, err
+}
+
+// arm programme la prochaine échéance ; doit être appelé verrouillé
+func (w *watchdog) arm() {
+	deadline, _ := w.next()
+	if deadline.IsZero() {
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+		return
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(time.Until(deadline), w.fire)
+		return
+	}
+	w.timer.Reset(time.Until(deadline))
+}
+
+// fire est appelé à l'échéance du timer
+func (w *watchdog) fire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	deadline, err := w.next()
+	if deadline.IsZero() || w.err != nil {
+		return
+	}
+	if remaining := time.Until(deadline); remaining > 0 {
+		// Activité entre-temps : on reprogramme
+		w.timer.Reset(remaining)
+		return
+	}
+	w.err = err
+	if w.body != nil {
+		w.body.Close()
+	}
+}
+
+// stop arrête la surveillance
+func (w *watchdog) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// expired retourne l'erreur de délai dépassé, le cas échéant
+func (w *watchdog) expired() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// watchedBody est un corps de réponse surveillé par un watchdog
+type watchedBody struct {
+	w    *watchdog
+	body io.ReadCloser
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		b.w.activity()
+	}
+	if err != nil {
+		if expired := b.w.expired(); expired != nil {
+			return n, expired
+		}
+	}
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	return b.body.Close()
+}
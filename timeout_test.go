@@ -0,0 +1,237 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// streamChunk formate un chunk SSE contenant le texte donné
+func streamChunk(content string) string {
+	return fmt.Sprintf("data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", content)
+}
+
+// pause attend la durée donnée ou l'abandon de la requête par le client
+func pause(r *http.Request, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-r.Context().Done():
+	}
+}
+
+func TestStreamTimeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		handler     func(w http.ResponseWriter, r *http.Request)
+		want        string
+		wantTimeout bool
+	}{
+		{
+			name: "idle timeout",
+			opts: []Option{WithIdleTimeout(50 * time.Millisecond)},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, streamChunk("Hello"))
+				w.(http.Flusher).Flush()
+				pause(r, time.Second)
+			},
+			want:        "Hello",
+			wantTimeout: true,
+		},
+		{
+			name: "first token timeout ignores keep-alives",
+			opts: []Option{WithFirstTokenTimeout(100 * time.Millisecond), WithIdleTimeout(time.Second)},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < 20; i++ {
+					fmt.Fprint(w, ": keep-alive\n\n")
+					w.(http.Flusher).Flush()
+					pause(r, 20*time.Millisecond)
+				}
+			},
+			wantTimeout: true,
+		},
+		{
+			name: "long stream not limited by request timeout",
+			opts: []Option{WithTimeout(100 * time.Millisecond), WithIdleTimeout(100 * time.Millisecond)},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				for _, word := range []string{"a", "b", "c", "d", "e"} {
+					fmt.Fprint(w, streamChunk(word))
+					w.(http.Flusher).Flush()
+					pause(r, 40*time.Millisecond)
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			},
+			want: "abcde",
+		},
+		{
+			name: "total deadline",
+			opts: []Option{WithDeadline(80 * time.Millisecond)},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < 10; i++ {
+					fmt.Fprint(w, streamChunk("x"))
+					w.(http.Flusher).Flush()
+					pause(r, 20*time.Millisecond)
+				}
+			},
+			wantTimeout: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(tt.handler))
+			defer server.Close()
+
+			opts := append(tt.opts, WithBaseURL(server.URL), WithStream(true))
+			got, err := Completion(modelStream, "test-token", "Hello", opts...)
+
+			if tt.wantTimeout {
+				if !errors.Is(err, ErrTimeout) {
+					t.Fatalf("expected ErrTimeout, got %v", err)
+				}
+				if tt.want != "" && got != tt.want {
+					t.Errorf("expected partial content %q, got %q", tt.want, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRequestTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"request timeout", []Option{WithTimeout(50 * time.Millisecond)}},
+		{"deadline across retries", []Option{WithDeadline(100 * time.Millisecond), WithRetry(5, 30*time.Millisecond)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.ReadAll(r.Body)
+				pause(r, time.Second)
+			}))
+			defer server.Close()
+
+			start := time.Now()
+			_, err := Completion(modelNonStream, "test-token", "Hello", append(tt.opts, WithBaseURL(server.URL))...)
+			if !errors.Is(err, ErrTimeout) {
+				t.Fatalf("expected ErrTimeout, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("timeout not enforced, call took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestStreamFirstTokenTimeoutRestart(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req apiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		requests++
+		if len(req.Messages) != 1 || req.N != 2 {
+			t.Errorf("request %d: expected the original request, got %d messages and n=%d", requests, len(req.Messages), req.N)
+		}
+		if requests == 1 {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			w.(http.Flusher).Flush()
+			pause(r, time.Second)
+			return
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Red\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":1,\"delta\":{\"content\":\"Blue\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	result, err := CompletionWithResult(modelStream, "test-token", "Hello",
+		WithBaseURL(server.URL), WithStream(true), WithN(2),
+		WithFirstTokenTimeout(50*time.Millisecond), WithStreamResume(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if len(result.Choices) != 2 || result.Choices[0].Content != "Red" || result.Choices[1].Content != "Blue" {
+		t.Errorf("unexpected choices %+v", result.Choices)
+	}
+}
+
+func TestStreamHeaderTimeoutCustomTransport(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"custom transport", []Option{WithTimeout(50 * time.Millisecond), WithTransport(http.DefaultTransport.(*http.Transport).Clone())}},
+		{"custom client", []Option{WithTimeout(50 * time.Millisecond), WithHTTPClient(&http.Client{})}},
+		{"custom client timeout", []Option{WithHTTPClient(&http.Client{Timeout: 50 * time.Millisecond})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.ReadAll(r.Body)
+				pause(r, time.Second)
+				fmt.Fprint(w, streamChunk("late"))
+			}))
+			defer server.Close()
+
+			start := time.Now()
+			_, err := Completion(modelStream, "test-token", "Hello",
+				append(tt.opts, WithBaseURL(server.URL), WithStream(true))...)
+			if !errors.Is(err, ErrTimeout) {
+				t.Fatalf("expected ErrTimeout, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("header timeout not enforced, call took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestStreamIdleTimeoutResume(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			fmt.Fprint(w, "id: 1\n"+streamChunk("Hello"))
+			w.(http.Flusher).Flush()
+			pause(r, time.Second)
+			return
+		}
+		fmt.Fprint(w, "id: 2\n"+streamChunk(" world"), "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	got, err := Completion(modelStream, "test-token", "Hello", WithBaseURL(server.URL),
+		WithStream(true), WithIdleTimeout(50*time.Millisecond), WithStreamResume(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "Hello world" {
+		t.Errorf("expected %q, got %q", "Hello world", got)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource fournit le token d'authentification. Il est consulté avant
+// chaque tentative, ce qui permet la rotation des identifiants sans
+// modifier le code appelant.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenRefresher est implémenté par les TokenSource capables de forcer le
+// renouvellement du token quand le serveur le refuse (401). Pour les autres
+// sources, Token est simplement rappelé.
+type TokenRefresher interface {
+	RefreshToken() (string, error)
+}
+
+// StaticToken est un token fixe
+type StaticToken string
+
+// Token retourne le token fixe
+func (t StaticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// EnvToken lit le token dans la variable d'environnement nommée, à chaque appel
+type EnvToken string
+
+// Token retourne la valeur de la variable d'environnement
+func (e EnvToken) Token() (string, error) {
+	token := strings.TrimSpace(os.Getenv(string(e)))
+	if token == "" {
+		return "", fmt.Errorf("%w: environment variable %s is not set", ErrEmptyToken, string(e))
+	}
+	return token, nil
+}
+
+// TokenFunc adapte une fonction en TokenSource
+type TokenFunc func() (string, error)
+
+// Token appelle la fonction
+func (f TokenFunc) Token() (string, error) {
+	return f()
+}
+
+// FileToken lit le token dans un fichier, relu quand sa date de modification
+// ou sa taille change (les espaces de début et de fin sont retirés)
+func FileToken(path string) TokenSource {
+	return &fileToken{path: path}
+}
+
+// fileToken est le TokenSource retourné par FileToken
+type fileToken struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// Token retourne le token, en relisant le fichier s'il a changé
+func (f *fileToken) Token() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading token file: %w", err)
+	}
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+	return f.read(info)
+}
+
+// RefreshToken relit le fichier sans tenir compte de sa date de modification
+func (f *fileToken) RefreshToken() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading token file: %w", err)
+	}
+	return f.read(info)
+}
+
+// read lit le fichier ; doit être appelé verrouillé
+func (f *fileToken) read(info os.FileInfo) (string, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%w: token file %s is empty", ErrEmptyToken, f.path)
+	}
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	return token, nil
+}
+
+// refreshToken demande un nouveau token à la source, et indique s'il diffère du précédent
+func refreshToken(source TokenSource, previous string) (string, bool) {
+	var token string
+	var err error
+	if refresher, ok := source.(TokenRefresher); ok {
+		token, err = refresher.RefreshToken()
+	} else {
+		token, err = source.Token()
+	}
+	return token, err == nil && token != "" && token != previous
+}
+
+// doRequest exécute une requête construite avec le token courant. Si le
+// serveur refuse le token (401), celui-ci est renouvelé une fois et la
+// requête renvoyée avec le nouveau token.
+func doRequest(client *http.Client, options *Options, build func(token string) (*http.Request, error)) (*http.Response, error) {
+	token, err := options.TokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("error getting token: %w", err)
+	}
+	if token == "" {
+		return nil, ErrEmptyToken
+	}
+	options.redactor.addSecret(token)
+
+	send := chain(client.Do, options.Middlewares)
+	httpReq, err := build(token)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(httpReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// Renouvellement unique du token refusé
+	fresh, ok := refreshToken(options.TokenSource, token)
+	if !ok {
+		return resp, nil
+	}
+	resp.Body.Close()
+	options.redactor.addSecret(fresh)
+	options.logger().Info("token rejected, retrying with refreshed token")
+
+	httpReq, err = build(fresh)
+	if err != nil {
+		return nil, err
+	}
+	return send(httpReq)
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rotatingToken est une source dont le token change à chaque renouvellement
+type rotatingToken struct {
+	current   string
+	next      string
+	refreshes int
+}
+
+func (r *rotatingToken) Token() (string, error) { return r.current, nil }
+
+func (r *rotatingToken) RefreshToken() (string, error) {
+	r.refreshes++
+	r.current = r.next
+	return r.current, nil
+}
+
+func TestTokenSources(t *testing.T) {
+	t.Setenv("AIYOU_TOKEN_SOURCE_TEST", " env-token\n")
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		source  TokenSource
+		want    string
+		wantErr error
+	}{
+		{name: "static", source: StaticToken("static-token"), want: "static-token"},
+		{name: "env", source: EnvToken("AIYOU_TOKEN_SOURCE_TEST"), want: "env-token"},
+		{name: "env unset", source: EnvToken("AIYOU_TOKEN_SOURCE_UNSET"), wantErr: ErrEmptyToken},
+		{name: "file", source: FileToken(path), want: "file-token"},
+		{name: "missing file", source: FileToken(path + ".missing"), wantErr: os.ErrNotExist},
+		{name: "func", source: TokenFunc(func() (string, error) { return "func-token", nil }), want: "func-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.Token()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFileTokenReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source := FileToken(path)
+	if got, _ := source.Token(); got != "first" {
+		t.Fatalf("expected first, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("second-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := source.Token(); got != "second-token" {
+		t.Errorf("expected reloaded token, got %q", got)
+	}
+}
+
+func TestTokenSourceRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     func() TokenSource
+		valid      string
+		wantErr    error
+		wantTokens []string
+	}{
+		{
+			name:       "static token",
+			source:     func() TokenSource { return StaticToken("good") },
+			valid:      "good",
+			wantTokens: []string{"good"},
+		},
+		{
+			name:       "refreshed after 401",
+			source:     func() TokenSource { return &rotatingToken{current: "expired", next: "good"} },
+			valid:      "good",
+			wantTokens: []string{"expired", "good"},
+		},
+		{
+			name: "token func called again after 401",
+			source: func() TokenSource {
+				var calls int32
+				return TokenFunc(func() (string, error) {
+					if atomic.AddInt32(&calls, 1) == 1 {
+						return "expired", nil
+					}
+					return "good", nil
+				})
+			},
+			valid:      "good",
+			wantTokens: []string{"expired", "good"},
+		},
+		{
+			name:       "unchanged token is not resent",
+			source:     func() TokenSource { return StaticToken("revoked") },
+			valid:      "good",
+			wantErr:    ErrInvalidToken,
+			wantTokens: []string{"revoked"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokens []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token := r.Header.Get("Authorization")[len("Bearer "):]
+				tokens = append(tokens, token)
+				if token != tt.valid {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, `{"choices":[{"message":{"content":"Hi"}}]}`)
+			}))
+			defer server.Close()
+
+			_, err := Completion(modelNonStream, "", "Hello",
+				WithBaseURL(server.URL),
+				WithTokenSource(tt.source()),
+			)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(tokens) != fmt.Sprint(tt.wantTokens) {
+				t.Errorf("expected tokens %v, got %v", tt.wantTokens, tokens)
+			}
+		})
+	}
+}
+
+func TestTokenSourceError(t *testing.T) {
+	errVault := errors.New("vault unavailable")
+	var calls int
+	source := TokenFunc(func() (string, error) {
+		calls++
+		return "", errVault
+	})
+
+	_, err := Completion(modelNonStream, "", "Hello",
+		WithBaseURL("http://127.0.0.1:1"),
+		WithTokenSource(source),
+		WithRetry(1, time.Millisecond),
+	)
+	if !errors.Is(err, errVault) {
+		t.Fatalf("expected token source error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected token fetched on each attempt, got %d calls", calls)
+	}
+
+	if _, err := Completion(modelNonStream, "", "Hello"); !errors.Is(err, ErrEmptyToken) {
+		t.Errorf("expected ErrEmptyToken without token nor source, got %v", err)
+	}
+}
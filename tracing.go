@@ -0,0 +1,177 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"context"
+	"errors"
+)
+
+// Tracer crée les spans des appels. L'interface reprend le strict nécessaire
+// d'OpenTelemetry, afin d'être adaptée sans dépendance au SDK.
+//
+// Chaque appel (Completion, ListModels) ouvre un span, et chaque tentative
+// HTTP un span enfant. Le contexte retourné par Start est celui des requêtes
+// HTTP de la tentative : un middleware peut donc y propager la trace.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span est une opération tracée
+type Span interface {
+	// SetAttributes ajoute ou remplace des attributs
+	SetAttributes(attrs ...Attribute)
+
+	// AddEvent enregistre un événement horodaté
+	AddEvent(name string, attrs ...Attribute)
+
+	// RecordError enregistre une erreur et marque le span en échec
+	RecordError(err error)
+
+	// End termine le span
+	End()
+}
+
+// Attribute est un attribut de span ; Value est de type string, int, float64,
+// bool ou []string
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attr crée un attribut de span
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Attributs des conventions sémantiques OpenTelemetry GenAI
+const (
+	AttrOperationName         = "gen_ai.operation.name"
+	AttrSystem                = "gen_ai.system"
+	AttrRequestModel          = "gen_ai.request.model"
+	AttrRequestTemperature    = "gen_ai.request.temperature"
+	AttrRequestChoiceCount    = "gen_ai.request.choice.count"
+	AttrResponseID            = "gen_ai.response.id"
+	AttrResponseModel         = "gen_ai.response.model"
+	AttrResponseFinishReasons = "gen_ai.response.finish_reasons"
+	AttrUsageInputTokens      = "gen_ai.usage.input_tokens"
+	AttrUsageOutputTokens     = "gen_ai.usage.output_tokens"
+	AttrErrorType             = "error.type"
+	AttrHTTPStatusCode        = "http.response.status_code"
+	AttrAttempt               = "aiyou.attempt"
+	AttrStream                = "aiyou.stream"
+)
+
+// Noms des spans de tentative et des événements
+const (
+	SpanAttempt     = "aiyou.attempt"
+	EventFirstToken = "gen_ai.first_token"
+	EventStreamEnd  = "gen_ai.stream.end"
+)
+
+// Valeurs des attributs
+const (
+	operationChat        = "chat"
+	operationListModels  = "list_models"
+	systemName           = "aiyou"
+	errorTypeOther       = "_OTHER"
+	errorTypeDecodeError = "decode_error"
+)
+
+// errorTypes associe les erreurs sentinelles à l'attribut error.type
+var errorTypes = []struct {
+	err  error
+	name string
+}{
+	{ErrTimeout, "timeout"},
+	{ErrRateLimit, "rate_limit"},
+	{ErrInvalidToken, "invalid_token"},
+	{ErrEmptyToken, "empty_token"},
+	{ErrStreamAborted, "stream_aborted"},
+	{ErrStreamCorrupted, "stream_corrupted"},
+	{ErrNoContent, "no_content"},
+	{ErrInvalidOption, "invalid_option"},
+	{context.Canceled, "canceled"},
+}
+
+// errorType retourne la valeur de l'attribut error.type d'une erreur
+func errorType(err error) string {
+	for _, e := range errorTypes {
+		if errors.Is(err, e.err) {
+			return e.name
+		}
+	}
+	var streamErr *StreamError
+	if errors.As(err, &streamErr) && streamErr.APIError != nil && streamErr.APIError.Type != "" {
+		return streamErr.APIError.Type
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Type != "" {
+		return apiErr.Type
+	}
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return errorTypeDecodeError
+	}
+	return errorTypeOther
+}
+
+// tracer retourne le tracer de l'appel, ou un tracer inactif
+func (o *Options) tracer() Tracer {
+	if o.Tracer == nil {
+		return noopTracer{}
+	}
+	return o.Tracer
+}
+
+// startSpan ouvre un span enfant du contexte de l'appel
+func (o *Options) startSpan(name string, attrs ...Attribute) (context.Context, Span) {
+	return o.tracer().Start(o.ctx, name, attrs...)
+}
+
+// endSpan enregistre l'erreur éventuelle puis termine le span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.SetAttributes(Attr(AttrErrorType, errorType(err)))
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// resultAttributes retourne les attributs de réponse d'un résultat
+func resultAttributes(result *Result) []Attribute {
+	reasons := make([]string, len(result.Choices))
+	for i, c := range result.Choices {
+		reasons[i] = c.FinishReason
+	}
+	attrs := []Attribute{
+		Attr(AttrResponseFinishReasons, reasons),
+		Attr(AttrUsageInputTokens, result.Usage.PromptTokens),
+		Attr(AttrUsageOutputTokens, result.Usage.CompletionTokens),
+	}
+	if result.ID != "" {
+		attrs = append(attrs, Attr(AttrResponseID, result.ID))
+	}
+	if result.Model != "" {
+		attrs = append(attrs, Attr(AttrResponseModel, result.Model))
+	}
+	return attrs
+}
+
+// noopTracer est le tracer utilisé quand aucun n'est configuré
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// noopSpan est un span qui n'enregistre rien
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute)    {}
+func (noopSpan) AddEvent(string, ...Attribute) {}
+func (noopSpan) RecordError(error)             {}
+func (noopSpan) End()                          {}
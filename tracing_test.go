@@ -0,0 +1,174 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordedSpan est un span enregistré en mémoire
+type recordedSpan struct {
+	name   string
+	parent *recordedSpan
+	attrs  map[string]any
+	events []string
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) AddEvent(name string, _ ...Attribute) { s.events = append(s.events, name) }
+func (s *recordedSpan) RecordError(err error)                { s.err = err }
+func (s *recordedSpan) End()                                 { s.ended = true }
+
+// spanKey est la clé de contexte du span courant
+type spanKey struct{}
+
+// recordingTracer enregistre les spans en mémoire
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (tr *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, span)
+	tr.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestTracing(t *testing.T) {
+	tests := []struct {
+		name         string
+		stream       bool
+		handler      http.HandlerFunc
+		wantAttempts int
+		wantCall     map[string]any
+		wantEvents   []string
+	}{
+		{
+			name: "retried completion",
+			handler: func() http.HandlerFunc {
+				calls := 0
+				return func(w http.ResponseWriter, r *http.Request) {
+					calls++
+					if calls == 1 {
+						w.WriteHeader(http.StatusTooManyRequests)
+						return
+					}
+					fmt.Fprint(w, `{"id":"cmpl-1","model":"az-gpt-4o-2024","choices":[{"message":{"content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2}}`)
+				}
+			}(),
+			wantAttempts: 2,
+			wantCall: map[string]any{
+				AttrOperationName:         "chat",
+				AttrSystem:                "aiyou",
+				AttrRequestModel:          modelNonStream,
+				AttrResponseID:            "cmpl-1",
+				AttrResponseModel:         "az-gpt-4o-2024",
+				AttrResponseFinishReasons: []string{"stop"},
+				AttrUsageInputTokens:      5,
+				AttrUsageOutputTokens:     2,
+			},
+		},
+		{
+			name:   "stream events",
+			stream: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, streamChunk("Hello")+"data: [DONE]\n\n")
+			},
+			wantAttempts: 1,
+			wantCall:     map[string]any{AttrStream: true},
+			wantEvents:   []string{EventFirstToken, EventStreamEnd},
+		},
+		{
+			name: "error type",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			wantAttempts: 1,
+			wantCall:     map[string]any{AttrErrorType: "invalid_token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			tracer := &recordingTracer{}
+			Completion(modelNonStream, "test-token", "Hello",
+				WithBaseURL(server.URL),
+				WithStream(tt.stream),
+				WithRetry(1, time.Millisecond),
+				WithTracer(tracer),
+			)
+
+			call := tracer.spans[0]
+			if call.name != "chat "+modelNonStream || call.parent != nil || !call.ended {
+				t.Fatalf("unexpected call span %+v", call)
+			}
+			for key, want := range tt.wantCall {
+				if !reflect.DeepEqual(call.attrs[key], want) {
+					t.Errorf("call span: expected %s=%v, got %v", key, want, call.attrs[key])
+				}
+			}
+
+			attempts := tracer.spans[1:]
+			if len(attempts) != tt.wantAttempts {
+				t.Fatalf("expected %d attempt spans, got %d", tt.wantAttempts, len(attempts))
+			}
+			for i, a := range attempts {
+				if a.name != SpanAttempt || a.parent != call || !a.ended || a.attrs[AttrAttempt] != i {
+					t.Errorf("unexpected attempt span %d: %+v", i, a)
+				}
+			}
+			last := attempts[len(attempts)-1]
+			if tt.wantEvents != nil && !reflect.DeepEqual(last.events, tt.wantEvents) {
+				t.Errorf("expected events %v, got %v", tt.wantEvents, last.events)
+			}
+		})
+	}
+}
+
+func TestTracingListModels(t *testing.T) {
+	var traced bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"models":[{"name":"az-gpt-4o"}]}]`)
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		span, _ := req.Context().Value(spanKey{}).(*recordedSpan)
+		traced = span != nil && span.name == SpanAttempt
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	if _, err := ListModels("test-token", WithBaseURL(server.URL), WithTracer(tracer), WithTransport(transport)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tracer.spans) != 2 || tracer.spans[0].attrs[AttrOperationName] != "list_models" {
+		t.Errorf("unexpected spans %+v", tracer.spans)
+	}
+	if !traced {
+		t.Error("expected attempt span in request context")
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+// Version est la version du SDK, envoyée dans l'en-tête User-Agent
+const Version = "0.2.0"
+
+// userAgentPrefix identifie le SDK dans l'en-tête User-Agent
+const userAgentPrefix = "aiyou-go-sdk/" + Version
+
+// userAgent retourne l'en-tête User-Agent, suffixé du nom de l'application
+func userAgent(options *Options) string {
+	if options.AppName == "" {
+		return userAgentPrefix
+	}
+	return userAgentPrefix + " " + options.AppName
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// VoteConfig configure un vote majoritaire (self-consistency)
+type VoteConfig struct {
+	// Samples est le nombre de complétions générées
+	Samples int
+
+	// Concurrency est le nombre maximum de requêtes simultanées (0 : toutes)
+	Concurrency int
+
+	// Normalize transforme une réponse avant le décompte, par exemple pour
+	// extraire une étiquette (par défaut : espaces de début et de fin retirés).
+	// Une réponse normalisée vide n'est pas comptée.
+	Normalize func(string) string
+}
+
+// VoteResult représente le résultat d'un vote majoritaire
+type VoteResult struct {
+	// Answer est la réponse normalisée majoritaire (en cas d'égalité,
+	// celle apparue dans le premier échantillon)
+	Answer string
+
+	// Count est le nombre de voix obtenues par Answer
+	Count int
+
+	// Votes est la distribution des voix par réponse normalisée
+	Votes map[string]int
+
+	// Samples contient les réponses brutes, dans l'ordre des échantillons
+	// (vide pour un échantillon en échec)
+	Samples []string
+
+	// Errors contient les erreurs des échantillons en échec
+	Errors []error
+
+	// Usage est la consommation cumulée de tous les échantillons
+	Usage Usage
+}
+
+// Vote envoie plusieurs fois le même message et retourne la réponse
+// majoritaire. Les échantillons sont générés en parallèle dans la limite de
+// config.Concurrency, chacun avec les options fournies (dont la politique de
+// retry). Une erreur n'est retournée que si aucun échantillon n'a pu voter.
+func Vote(
+	model string,
+	token string,
+	message string,
+	config VoteConfig,
+	opts ...Option,
+) (*VoteResult, error) {
+	if config.Samples < 1 {
+		return nil, fmt.Errorf("%w: samples must be at least 1, got %d", ErrInvalidOption, config.Samples)
+	}
+	if config.Concurrency < 0 {
+		return nil, fmt.Errorf("%w: concurrency must not be negative, got %d", ErrInvalidOption, config.Concurrency)
+	}
+	concurrency := config.Concurrency
+	if concurrency == 0 || concurrency > config.Samples {
+		concurrency = config.Samples
+	}
+	normalize := config.Normalize
+	if normalize == nil {
+		normalize = strings.TrimSpace
+	}
+
+	// Génération des échantillons
+	results := make([]*Result, config.Samples)
+	errs := make([]error, config.Samples)
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < config.Samples; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i], errs[i] = CompletionWithResult(model, token, message, opts...)
+		}(i)
+	}
+	wg.Wait()
+
+	// Décompte des voix
+	vote := &VoteResult{
+		Votes:   make(map[string]int),
+		Samples: make([]string, config.Samples),
+	}
+	var order []string
+	for i, result := range results {
+		if result != nil {
+			vote.Usage.add(result.Usage)
+		}
+		if errs[i] != nil {
+			vote.Errors = append(vote.Errors, fmt.Errorf("sample %d: %w", i, errs[i]))
+			continue
+		}
+		vote.Samples[i] = result.Content
+		answer := normalize(result.Content)
+		if answer == "" {
+			continue
+		}
+		if vote.Votes[answer] == 0 {
+			order = append(order, answer)
+		}
+		vote.Votes[answer]++
+	}
+
+	for _, answer := range order {
+		if vote.Votes[answer] > vote.Count {
+			vote.Answer, vote.Count = answer, vote.Votes[answer]
+		}
+	}
+	if vote.Count == 0 {
+		if len(vote.Errors) == 0 {
+			return vote, ErrNoVotes
+		}
+		return vote, fmt.Errorf("%w: %w", ErrNoVotes, errors.Join(vote.Errors...))
+	}
+	return vote, nil
+}
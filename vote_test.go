@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Cyrille BARTHELEMY
+//
+// This software is released under the MIT License.
+// https://github.com/n1neT10ne/aiyou-go-sdk/blob/main/LICENSE
+
+package aiyou
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVote(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		calls    int
+		inFlight int32
+		maxSeen  int32
+	)
+	answers := []string{"Positive", " positive.", "Negative", "POSITIVE", "neutral"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxSeen)
+			if n <= seen || atomic.CompareAndSwapInt32(&maxSeen, seen, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		answer := answers[calls%len(answers)]
+		calls++
+		mu.Unlock()
+		fmt.Fprintf(w, `{"response":{"choices":[{"message":{"content":%q}}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}}`, answer)
+	}))
+	defer server.Close()
+
+	normalize := func(s string) string {
+		return strings.Trim(strings.ToLower(strings.TrimSpace(s)), ".")
+	}
+	got, err := Vote(modelNonStream, "test-token", "Classify: I love it",
+		VoteConfig{Samples: 5, Concurrency: 2, Normalize: normalize}, WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Answer != "positive" || got.Count != 3 {
+		t.Errorf("expected positive with 3 votes, got %q with %d", got.Answer, got.Count)
+	}
+	if got.Votes["negative"] != 1 || got.Votes["neutral"] != 1 {
+		t.Errorf("unexpected vote distribution: %v", got.Votes)
+	}
+	if got.Usage.TotalTokens != 20 {
+		t.Errorf("expected 20 total tokens, got %d", got.Usage.TotalTokens)
+	}
+	if len(got.Samples) != 5 {
+		t.Errorf("expected 5 samples, got %d", len(got.Samples))
+	}
+	if maxSeen > 2 {
+		t.Errorf("concurrency limit not respected: %d requests in flight", maxSeen)
+	}
+}
+
+func TestVoteWithFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%2 == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"response":{"choices":[{"message":{"content":"yes"}}]}}`)
+	}))
+	defer server.Close()
+
+	got, err := Vote(modelNonStream, "test-token", "Hello", VoteConfig{Samples: 4, Concurrency: 1}, WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Answer != "yes" || got.Count != 2 || len(got.Errors) != 2 {
+		t.Errorf("expected 2 votes and 2 errors, got %+v", got)
+	}
+}
+
+func TestVoteErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := Vote(modelNonStream, "test-token", "Hello", VoteConfig{Samples: 3}, WithBaseURL(server.URL))
+	if !errors.Is(err, ErrNoVotes) || !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrNoVotes wrapping ErrInvalidToken, got %v", err)
+	}
+
+	_, err = Vote(modelNonStream, "test-token", "Hello", VoteConfig{Samples: 0})
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption, got %v", err)
+	}
+}